@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"claudeload/internal/anchor"
+)
+
+var licenseText = []byte("// (c) Anthropic PBC. All rights reserved. Use is subject to the Legal Agreements outlined here: https://code.claude.com/docs/en/legal-and-compliance.")
+
+// defaultAnchors are tried when the user config does not override them. The
+// license banner is a whole-line comment, so overwriting it is harmless.
+var defaultAnchors = []anchor.Anchor{
+	{Name: "license-comment", Kind: anchor.KindLiteral, Pattern: string(licenseText), Priority: 100},
+	{Name: "anthropic-banner", Kind: anchor.KindRegex, Pattern: `// \(c\) Anthropic PBC\.[^\n]*`, Priority: 50},
+	{Name: "after-first-import", Kind: anchor.KindAfterImport, Priority: 0},
+}
+
+// loadAnchors merges the user anchor file over defaultAnchors. An empty path
+// means anchor.DefaultConfigPath, which need not exist.
+func loadAnchors(path string) ([]anchor.Anchor, error) {
+	explicit := path != ""
+	if !explicit {
+		p, err := anchor.DefaultConfigPath()
+		if err != nil {
+			return defaultAnchors, nil
+		}
+		path = p
+	}
+	user, err := anchor.Load(path)
+	if os.IsNotExist(err) && !explicit {
+		return anchor.Merge(defaultAnchors, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logv("[*] Loaded %d patch anchors from %s\n", len(user), path)
+	return anchor.Merge(defaultAnchors, user), nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"claudeload/internal/bunfmt"
+)
+
+func runEmbed(args []string) {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	as := fs.String("as", "", "module name to embed the file as (default: <root>/claudeload/<file name>)")
+	loader := fs.String("loader", "", "Bun loader for the module, e.g. js or text (default: by extension)")
+	format := fs.String("format", "", "module format for JavaScript: esm, cjs or none (default: by extension, else the entry point's)")
+	editOpts := addEditFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload embed [--as name] [--loader name] [--format esm|cjs|none] [-o out | --no-backup] <file> [<path>]\n")
+		fs.PrintDefaults()
+	}
+	pos := parseInterspersed(fs, args)
+	if len(pos) < 1 || len(pos) > 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	file := pos[0]
+	exePath := resolveClaudePath(pos[1:])
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+
+	var added string
+	written := editGraph(exePath, *editOpts, func(exe *bunfmt.ExecutableData, g *bunfmt.Graph, m *installManifest) error {
+		name := *as
+		if name == "" {
+			name = defaultEmbedName(exe, file)
+		}
+		f := bunfmt.NewGraphFile(name, data)
+		if *loader != "" {
+			l, ok := bunfmt.LoaderByName(*loader)
+			if !ok {
+				return fmt.Errorf("unknown loader %q", *loader)
+			}
+			f.Loader = l
+		}
+		if *format != "" {
+			mf, ok := moduleFormatByName(*format)
+			if !ok {
+				return fmt.Errorf("--format must be esm, cjs or none, not %q", *format)
+			}
+			f.ModuleFormat = mf
+		} else if f.ModuleFormat == 0 && bunfmt.IsSourceLoader(f.Loader) && int(g.EntryPointID) < len(g.Files) {
+			f.ModuleFormat = g.Files[g.EntryPointID].ModuleFormat
+		}
+		idx, err := g.AddFile(f)
+		if err != nil {
+			return err
+		}
+		added = name
+		m.Embedded = append(m.Embedded, name)
+		fmt.Printf("[*] Embedding %s as [%d] %s (%d bytes, loader=%s, encoding=%s)\n",
+			file, idx, name, len(data), bunfmt.LoaderName[f.Loader], bunfmt.EncodingName[f.Encoding])
+		return nil
+	})
+	fmt.Printf("[*] Embedded %s into %s\n", added, written)
+}
+
+// defaultEmbedName places file in a claudeload directory beside the entry
+// point, using the entry point's path separator.
+func defaultEmbedName(exe *bunfmt.ExecutableData, file string) string {
+	base := file[strings.LastIndexAny(file, `/\`)+1:]
+	entry := ""
+	if m, err := exe.GetModule(int(exe.Offsets.EntryPointID)); err == nil {
+		entry = exe.GetModuleName(m)
+	}
+	i := strings.LastIndexAny(entry, `/\`)
+	if i < 0 || bunfmt.ModuleRoot(entry) == "" {
+		return "/$bunfs/root/claudeload/" + base
+	}
+	sep := entry[i : i+1]
+	return entry[:i+1] + "claudeload" + sep + base
+}
+
+func moduleFormatByName(name string) (uint8, bool) {
+	for f, n := range bunfmt.ModuleFormatName {
+		if n == name {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// editOptions says where editGraph writes the edited binary.
+type editOptions struct {
+	// output writes the edited binary there instead of over the original,
+	// which is left alone along with its backup and manifest.
+	output string
+	// noBackup edits the binary in place without backing it up or recording
+	// the edit in a manifest.
+	noBackup bool
+}
+
+// addEditFlags registers the flags that fill in editOptions.
+func addEditFlags(fs *flag.FlagSet) *editOptions {
+	opts := &editOptions{}
+	fs.StringVar(&opts.output, "o", "", "write the edited binary to this path instead of editing in place")
+	fs.BoolVar(&opts.noBackup, "no-backup", false, "edit in place without a backup or manifest (uninstall cannot undo it)")
+	return opts
+}
+
+// editGraph writes exePath with its module graph changed by edit, which also
+// records the change in the install manifest, and returns the path written.
+// Editing in place keeps the manifest up to date, and the first edit of an
+// unpatched binary backs it up, so that uninstall restores it as it does
+// after install. With opts.output or opts.noBackup set there is no backup
+// and the manifest is not written.
+func editGraph(exePath string, opts editOptions, edit func(*bunfmt.ExecutableData, *bunfmt.Graph, *installManifest) error) string {
+	st, err := os.Stat(exePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	mode := st.Mode()
+	backupPath := exePath + ".original"
+	target := exePath
+	if opts.output != "" {
+		target = normalizePath(opts.output)
+	}
+	inPlace := target == exePath && !opts.noBackup
+
+	manifest, err := readManifest(exePath)
+	switch {
+	case err == nil && !inPlace:
+		if target == exePath {
+			fmt.Fprintf(os.Stderr, "[!] %s is managed by claudeload (%s); edit it with a backup, or write a copy with -o.\n", exePath, manifestPath(exePath))
+			os.Exit(1)
+		}
+	case os.IsNotExist(err) && !inPlace:
+		// The edit only needs somewhere to record itself.
+		manifest = &installManifest{}
+	case err == nil:
+		if sum, err := fileSHA256(exePath); err == nil && sum != manifest.PatchedSHA256 {
+			fmt.Fprintf(os.Stderr, "[!] %s has changed since claudeload last wrote it; run claudeload ensure first.\n", exePath)
+			os.Exit(1)
+		}
+		if !fileExists(backupPath) {
+			fmt.Fprintf(os.Stderr, "[!] backup %s is missing; reinstall Claude Code first.\n", backupPath)
+			os.Exit(1)
+		}
+	case os.IsNotExist(err):
+		original := exePath
+		if fileExists(backupPath) {
+			original = backupPath
+		}
+		originalSum, err := fileSHA256(original)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+		manifest = &installManifest{
+			Version:        version,
+			InstalledAt:    time.Now().UTC(),
+			Executable:     exePath,
+			Backup:         backupPath,
+			OriginalSHA256: originalSum,
+			Files:          []string{backupPath},
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+
+	tx, stopSignals := beginTx(target)
+
+	exe, err := bunfmt.LoadExecutable(exePath, verbose)
+	if err != nil {
+		abortTx(tx, "%v", err)
+	}
+	defer exe.Close()
+	if err := exe.Validate(); err != nil {
+		printPlanError(err)
+		abortTx(tx, "Cannot edit %s.", exePath)
+	}
+	g, err := exe.Graph()
+	if err != nil {
+		abortTx(tx, "%v", err)
+	}
+	if err := edit(exe, g, manifest); err != nil {
+		abortTx(tx, "%v", err)
+	}
+
+	if inPlace && !fileExists(backupPath) {
+		if err := tx.CopyFile(exePath, backupPath, mode); err != nil {
+			abortTx(tx, "failed to write backup: %v", permHint(err))
+		}
+	}
+	if err := tx.WriteFile(target, mode, func(f *os.File) error {
+		w := bufio.NewWriter(f)
+		if err := exe.WriteExecutable(w, g); err != nil {
+			return err
+		}
+		return w.Flush()
+	}); err != nil {
+		abortTx(tx, "failed to write executable: %v", permHint(err))
+	}
+	if runtime.GOOS == "darwin" {
+		if err := resignBinary(target); err != nil {
+			abortTx(tx, "%v", err)
+		}
+	}
+
+	if inPlace {
+		if manifest.PatchedSHA256, err = fileSHA256(exePath); err != nil {
+			abortTx(tx, "failed to hash executable: %v", err)
+		}
+		if err := tx.WriteFile(manifestPath(exePath), 0o644, manifest.writeTo); err != nil {
+			abortTx(tx, "failed to write manifest: %v", permHint(err))
+		}
+	}
+
+	stopSignals()
+	if err := tx.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] written, but failed to clean up: %v\n", err)
+	}
+	return target
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"claudeload/internal/bunfmt"
+)
+
+func TestEditGraphOutput(t *testing.T) {
+	const added = "/$bunfs/root/claudeload/extra.js"
+	tests := []struct {
+		name string
+		opts func(dir string) editOptions
+		// wantTarget is the file written, relative to dir.
+		wantTarget string
+		// wantBackup says whether claude.original and the manifest are
+		// written.
+		wantBackup bool
+	}{
+		{"in place", func(dir string) editOptions { return editOptions{} }, "claude", true},
+		{"no backup", func(dir string) editOptions { return editOptions{noBackup: true} }, "claude", false},
+		{"output", func(dir string) editOptions { return editOptions{output: filepath.Join(dir, "claude-edited")} }, "claude-edited", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			exePath := writeExe(t, dir, testGraph())
+			original, err := os.ReadFile(exePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written := editGraph(exePath, tt.opts(dir), func(exe *bunfmt.ExecutableData, g *bunfmt.Graph, m *installManifest) error {
+				_, err := g.AddFile(bunfmt.NewGraphFile(added, []byte("export {};\n")))
+				m.Embedded = append(m.Embedded, added)
+				return err
+			})
+			if want := filepath.Join(dir, tt.wantTarget); written != want {
+				t.Errorf("editGraph wrote %s, want %s", written, want)
+			}
+			if _, _, err := loadExe(t, written).FindModuleByName(added); err != nil {
+				t.Errorf("edited binary: %v", err)
+			}
+			if written != exePath {
+				if got, _ := os.ReadFile(exePath); string(got) != string(original) {
+					t.Error("the original binary changed")
+				}
+			}
+
+			if got := fileExists(exePath + ".original"); got != tt.wantBackup {
+				t.Errorf("backup written = %t, want %t", got, tt.wantBackup)
+			}
+			m, err := readManifest(exePath)
+			if !tt.wantBackup {
+				if !os.IsNotExist(err) {
+					t.Errorf("manifest written (%v), want none", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readManifest: %v", err)
+			}
+			if len(m.Embedded) != 1 || m.Embedded[0] != added {
+				t.Errorf("manifest records embedded %v, want [%s]", m.Embedded, added)
+			}
+			if err := verifyManifest(m, exePath); err != nil {
+				t.Errorf("verifyManifest: %v", err)
+			}
+		})
+	}
+}
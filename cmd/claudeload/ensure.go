@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runEnsure makes sure the binary is patched without ever downgrading it.
+// Claude Code updates itself by replacing the binary, which drops the patch
+// and leaves behind a backup of the previous release; plain install would
+// restore that backup. ensure instead recognises the backup as stale,
+// discards it and patches the new binary.
+func runEnsure(args []string) {
+	fs := flag.NewFlagSet("ensure", flag.ExitOnError)
+	force := fs.Bool("force", false, "re-patch even if the binary reports an older version than the backup")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload ensure [--force] [<path>]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	exePath := resolveClaudePath(fs.Args())
+	backupPath := exePath + ".original"
+
+	// Re-patch the module chosen at install time; it is recorded by name
+	// because indices shift between releases.
+	var opts installOptions
+	m, err := loadManifest(exePath)
+	if err == nil {
+		opts.module = m.Module.Name
+	}
+
+	cur, err := probePatch(exePath, opts.module)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	f := ensureFacts{exePath: exePath, backupPath: backupPath, cur: cur, manifest: m, hasBackup: fileExists(backupPath)}
+	if !cur.patched && f.hasBackup {
+		if f.sum, err = fileSHA256(exePath); err == nil {
+			f.backupSum, err = fileSHA256(backupPath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+		if f.old, err = probePatch(backupPath, opts.module); err != nil {
+			logv("[*] Could not read backup: %v\n", err)
+			f.old = &patchProbe{}
+		}
+	}
+
+	action, err := f.decide(*force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	switch action {
+	case ensureUpToDate:
+		fmt.Printf("[*] %s is already patched\n", exePath)
+		return
+	case ensureDiscardBackup:
+		if !cur.version.IsZero() && !f.old.version.IsZero() {
+			fmt.Printf("[*] Claude Code changed from %s to %s; discarding stale backup\n", f.old.version, cur.version)
+		} else {
+			fmt.Printf("[*] %s was replaced since it was patched; discarding stale backup\n", exePath)
+		}
+		opts.discardBackup = true
+	}
+	runInstall(exePath, opts)
+}
+
+// ensureAction is what ensure does about a binary.
+type ensureAction int
+
+const (
+	ensureUpToDate      ensureAction = iota // already patched; nothing to do
+	ensureInstall                           // install as usual, from the backup if there is one
+	ensureDiscardBackup                     // the backup is stale: drop it and patch the binary
+)
+
+// ensureFacts is what ensure learns about a binary and its backup. The
+// hashes and the backup's probe are only filled in when the binary is
+// unpatched and has a backup.
+type ensureFacts struct {
+	exePath, backupPath string
+	cur, old            *patchProbe
+	hasBackup           bool
+	sum, backupSum      string
+	manifest            *installManifest
+}
+
+// decide works out the ensureAction. Unless force is set it refuses to
+// replace a backup with a binary reporting an older version.
+func (f ensureFacts) decide(force bool) (ensureAction, error) {
+	switch {
+	case f.cur.patched && f.hasBackup:
+		return ensureUpToDate, nil
+	case f.cur.patched:
+		return 0, fmt.Errorf("%s is patched but its backup %s is missing; reinstall Claude Code, then run ensure again", f.exePath, f.backupPath)
+	case !f.hasBackup:
+		return ensureInstall, nil
+	}
+
+	m := f.manifest
+	if f.sum == f.backupSum || (m != nil && m.Executable == f.exePath && f.sum == m.PatchedSHA256) {
+		// The binary was restored by hand, or only embed has written it; the
+		// backup is still good.
+		return ensureInstall, nil
+	}
+	if !force && !f.cur.version.IsZero() && !f.old.version.IsZero() && f.cur.version.Less(f.old.version) {
+		return 0, fmt.Errorf("%s reports version %s, older than the backup (%s); refusing to discard the newer backup\n"+
+			"  hint: re-run with --force to patch the older binary anyway", f.exePath, f.cur.version, f.old.version)
+	}
+	return ensureDiscardBackup, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"claudeload/internal/bunfmt"
+)
+
+func TestEnsureDecide(t *testing.T) {
+	const exePath = "/bin/claude"
+	v := func(minor int) bunfmt.Version { return bunfmt.Version{Major: 2, Minor: minor} }
+	install := &installManifest{Executable: exePath, PatchedSHA256: "embedded", OriginalSHA256: "original"}
+	otherInstall := &installManifest{Executable: "/bin/claude-1", PatchedSHA256: "embedded", OriginalSHA256: "original"}
+
+	tests := []struct {
+		name    string
+		facts   ensureFacts
+		force   bool
+		want    ensureAction
+		wantErr string
+	}{
+		{"already patched", ensureFacts{cur: &patchProbe{patched: true}, hasBackup: true}, false, ensureUpToDate, ""},
+		{"patched without backup", ensureFacts{cur: &patchProbe{patched: true}}, false, 0, "backup"},
+		{"never installed", ensureFacts{cur: &patchProbe{}}, false, ensureInstall, ""},
+		{"restored by hand", ensureFacts{
+			cur: &patchProbe{version: v(1)}, old: &patchProbe{version: v(1)}, hasBackup: true,
+			sum: "original", backupSum: "original",
+		}, false, ensureInstall, ""},
+		{"embed only", ensureFacts{
+			cur: &patchProbe{}, old: &patchProbe{}, hasBackup: true, manifest: install,
+			sum: "embedded", backupSum: "original",
+		}, false, ensureInstall, ""},
+		{"embed of another binary", ensureFacts{
+			cur: &patchProbe{}, old: &patchProbe{}, hasBackup: true, manifest: otherInstall,
+			sum: "embedded", backupSum: "original",
+		}, false, ensureDiscardBackup, ""},
+		{"updated", ensureFacts{
+			cur: &patchProbe{version: v(2)}, old: &patchProbe{version: v(1)}, hasBackup: true,
+			sum: "updated", backupSum: "original",
+		}, false, ensureDiscardBackup, ""},
+		{"replaced, versions unknown", ensureFacts{
+			cur: &patchProbe{}, old: &patchProbe{}, hasBackup: true,
+			sum: "updated", backupSum: "original",
+		}, false, ensureDiscardBackup, ""},
+		{"downgraded", ensureFacts{
+			cur: &patchProbe{version: v(1)}, old: &patchProbe{version: v(2)}, hasBackup: true,
+			sum: "older", backupSum: "original",
+		}, false, 0, "older than the backup"},
+		{"downgraded with force", ensureFacts{
+			cur: &patchProbe{version: v(1)}, old: &patchProbe{version: v(2)}, hasBackup: true,
+			sum: "older", backupSum: "original",
+		}, true, ensureDiscardBackup, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.facts.exePath, tt.facts.backupPath = exePath, exePath+".original"
+			got, err := tt.facts.decide(tt.force)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decide error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decide: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("decide = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
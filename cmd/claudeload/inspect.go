@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"claudeload/internal/bunfmt"
+)
+
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	strict := fs.Bool("strict", false, "fail if the module graph does not pass integrity validation")
+	moduleInfo := fs.Bool("module-info", false, "decode each module's module_info: its imports, exports and star re-exports")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload inspect [--json] [--strict] [--module-info] <path>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	exePath := normalizePath(fs.Arg(0))
+
+	// Verbose loader output would corrupt the JSON on stdout.
+	exe, err := bunfmt.LoadExecutable(exePath, verbose && !*asJSON)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	defer exe.Close()
+
+	if *strict {
+		if err := exe.Validate(); err != nil {
+			printValidationErrors(err)
+			os.Exit(1)
+		}
+	}
+	report, err := exe.Inspect(exePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	if *moduleInfo {
+		if err := exe.AddModuleInfo(report); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printReport(report)
+}
+
+func printReport(r *bunfmt.Report) {
+	fmt.Printf("path:              %s\n", r.Path)
+	if r.BunVersion != "" {
+		fmt.Printf("bun_version:       %s\n", r.BunVersion)
+	}
+	fmt.Printf("layout:            %s\n", r.Layout)
+	if r.Section != nil {
+		fmt.Printf("section:           %s %s (offset=%d, size=%d)\n", r.Section.Format, r.Section.Name, r.Section.Offset, r.Section.Size)
+	} else {
+		fmt.Printf("section:           <none, appended>\n")
+	}
+	fmt.Printf("trailer_offset:    %d\n", r.TrailerOffset)
+	fmt.Printf("blob:              [%d, %d) (%d bytes)\n", r.BlobStart, r.BlobEnd, r.ByteCount)
+	fmt.Printf("entry_point:       [%d] %s\n", r.EntryPointID, r.EntryPoint)
+	fmt.Printf("compile_exec_argv: %s\n", orNone(r.CompileExecArgv))
+	fmt.Printf("flags:             %b (%d)\n", r.Flags, r.Flags)
+	fmt.Printf("modules:           %d\n\n", len(r.Modules))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "#\tloader\tencoding\tformat\tside\tcontents\tsourcemap\tbytecode\tmodule_info\t\tname")
+	for _, m := range r.Modules {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t\t%s\n",
+			m.Index, m.Loader, m.Encoding, m.Format, m.Side,
+			m.ContentsSize, m.SourceMapSize, m.BytecodeSize, m.ModuleInfoSize, m.Name)
+	}
+	tw.Flush()
+
+	for _, m := range r.Modules {
+		if m.ModuleInfo != nil || m.ModuleInfoError != "" {
+			printModuleInfo(m)
+		}
+	}
+}
+
+// printModuleInfo prints a module's import and export records as the
+// declarations they come from.
+func printModuleInfo(m bunfmt.ModuleReport) {
+	fmt.Printf("\n[%d] %s\n", m.Index, m.Name)
+	if m.ModuleInfoError != "" {
+		fmt.Printf("  [!] %s\n", m.ModuleInfoError)
+		return
+	}
+	info := m.ModuleInfo
+	var flags []string
+	if info.IsTypeScript {
+		flags = append(flags, "typescript")
+	}
+	if info.ContainsImportMeta {
+		flags = append(flags, "import.meta")
+	}
+	if len(flags) > 0 {
+		fmt.Printf("  // %s\n", strings.Join(flags, ", "))
+	}
+	for _, rm := range info.RequestedModules {
+		if rm.Type != "" {
+			fmt.Printf("  // requests %q with type %q\n", rm.Specifier, rm.Type)
+		}
+	}
+	for _, im := range info.Imports {
+		switch {
+		case im.Name == "*":
+			fmt.Printf("  import * as %s from %q\n", im.Local, im.Module)
+		case im.TypeScript:
+			fmt.Printf("  import { %s } from %q // may be a type\n", alias(im.Name, im.Local), im.Module)
+		default:
+			fmt.Printf("  import { %s } from %q\n", alias(im.Name, im.Local), im.Module)
+		}
+	}
+	for _, ex := range info.Exports {
+		switch {
+		case ex.Module == "":
+			fmt.Printf("  export { %s }\n", alias(ex.Local, ex.Name))
+		case ex.Import == "*":
+			fmt.Printf("  export * as %s from %q\n", ex.Name, ex.Module)
+		default:
+			fmt.Printf("  export { %s } from %q\n", alias(ex.Import, ex.Name), ex.Module)
+		}
+	}
+	for _, mod := range info.StarExports {
+		fmt.Printf("  export * from %q\n", mod)
+	}
+}
+
+// alias renders a binding of name to local as in an import or export list.
+func alias(name, local string) string {
+	if name == local {
+		return name
+	}
+	return name + " as " + local
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	_ "embed"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"claudeload/internal/bunfmt"
 )
@@ -22,7 +25,6 @@ const version = "1.0.0"
 
 var (
 	payloadData = []byte("eval(require('fs').readFileSync(require('path').join(require('path').dirname(process.execPath),'payload.js'),'utf8'))")
-	licenseText = []byte("// (c) Anthropic PBC. All rights reserved. Use is subject to the Legal Agreements outlined here: https://code.claude.com/docs/en/legal-and-compliance.")
 	verbose     bool
 )
 
@@ -43,7 +45,10 @@ func normalizePath(p string) string {
 }
 
 func writeFileWithPermHint(path string, data []byte, mode os.FileMode) error {
-	err := os.WriteFile(path, data, mode)
+	return permHint(os.WriteFile(path, data, mode))
+}
+
+func permHint(err error) error {
 	if err != nil && errors.Is(err, os.ErrPermission) {
 		return fmt.Errorf("%w\n  hint: try re-running with sudo", err)
 	}
@@ -56,6 +61,13 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  claudeload install                     install payload into claude binary from PATH\n")
 	fmt.Fprintf(os.Stderr, "  claudeload uninstall [<path>]          restore original binary from PATH\n")
 	fmt.Fprintf(os.Stderr, "  claudeload extract [--beautify] <path> extract embedded modules\n")
+	fmt.Fprintf(os.Stderr, "  claudeload pack --base <exe> <dir>     rebuild an executable from an extraction\n")
+	fmt.Fprintf(os.Stderr, "  claudeload inspect [--json] <path>     show graph layout and module table\n")
+	fmt.Fprintf(os.Stderr, "  claudeload status [<path>]             report whether the claude binary is patched\n")
+	fmt.Fprintf(os.Stderr, "  claudeload ensure [<path>]             re-apply the patch after a Claude Code update\n")
+	fmt.Fprintf(os.Stderr, "  claudeload watch [<path>]              run ensure whenever the claude binary changes\n")
+	fmt.Fprintf(os.Stderr, "  claudeload embed <file> [--as name]    add a module to the claude binary\n")
+	fmt.Fprintf(os.Stderr, "  claudeload module replace|rm <name>    replace a module's contents or remove it\n")
 	fmt.Fprintf(os.Stderr, "  claudeload plugin list                 list installed plugins\n")
 	fmt.Fprintf(os.Stderr, "  claudeload plugin add <file.js>        install a plugin\n")
 	fmt.Fprintf(os.Stderr, "  claudeload plugin remove <name.js>     remove a plugin\n")
@@ -67,11 +79,13 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "  left in place.\n\n")
 	fmt.Fprintf(os.Stderr, "Flags:\n")
 	fmt.Fprintf(os.Stderr, "  -v    verbose output\n")
+	fmt.Fprintf(os.Stderr, "  -mmap memory-map executables instead of reading them\n")
 }
 
 func main() {
 
 	flag.BoolVar(&verbose, "v", false, "verbose output")
+	flag.BoolVar(&bunfmt.UseMmap, "mmap", false, "memory-map executables instead of reading them")
 	flag.Usage = printUsage
 	flag.Parse()
 
@@ -89,13 +103,25 @@ func main() {
 
 	switch cmd {
 	case "install":
-		exePath := resolveClaudePath(subArgs)
-		runInstall(exePath)
+		runInstallCmd(subArgs)
+	case "ensure", "reinstall":
+		runEnsure(subArgs)
+	case "watch":
+		runWatch(subArgs)
 	case "uninstall":
-		exePath := resolveClaudePath(subArgs)
-		runUninstall(exePath)
+		runUninstall(subArgs)
 	case "extract":
 		runExtract(subArgs)
+	case "pack":
+		runPack(subArgs)
+	case "inspect":
+		runInspect(subArgs)
+	case "status":
+		runStatus(subArgs)
+	case "embed":
+		runEmbed(subArgs)
+	case "module":
+		runModuleCmd(subArgs)
 	case "plugin":
 		runPluginCmd(subArgs)
 	case "version":
@@ -121,6 +147,39 @@ func resolveClaudePath(args []string) string {
 	return exePath
 }
 
+// parseInterspersed parses args with fs, allowing flags to follow positional
+// arguments, and returns the positional arguments. Everything after "--" is
+// positional, so that a file named like a flag can still be given.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return pos
+		}
+		if consumed := len(args) - fs.NArg(); consumed > 0 && args[consumed-1] == "--" &&
+			(consumed < 2 || !takesValue(fs, args[consumed-2])) {
+			return append(pos, fs.Args()...)
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// takesValue reports whether arg is a flag of fs that consumes the next
+// argument as its value.
+func takesValue(fs *flag.FlagSet, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+	f := fs.Lookup(strings.TrimLeft(arg, "-"))
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
 func resolvePluginDir() (string, error) {
 	p, err := findClaudeInPath("claude")
 	if err != nil {
@@ -131,22 +190,149 @@ func resolvePluginDir() (string, error) {
 
 func runExtract(args []string) {
 	fs := flag.NewFlagSet("extract", flag.ExitOnError)
-	beautify := fs.Bool("beautify", false, "beautify JS/TS output (requires js-beautify in PATH)")
+	beautify := fs.Bool("beautify", false, "also write a beautified copy of each JS/TS module")
+	beautifier := fs.String("beautifier", "builtin", "beautifier for --beautify: builtin, or js-beautify from PATH")
+	strict := fs.Bool("strict", false, "fail if the module graph does not pass integrity validation")
+	outputDir := fs.String("o", "", "output directory or archive (default: ./<name>_extracted[.<format>])")
+	format := fs.String("format", "", "output format: dir, tar, tar.gz or zip (default: by -o's extension)")
+	fromSourceMaps := fs.Bool("from-sourcemaps", false, "also write the original sources carried by source maps under sources/")
+	jobs := fs.Int("jobs", 0, "modules to process in parallel (default: GOMAXPROCS)")
+	stdout := fs.String("stdout", "", "write the contents of one module, by index or name, to stdout instead")
+	var include, exclude, loaders stringList
+	fs.Var(&include, "include", "only extract modules whose name matches this glob (repeatable)")
+	fs.Var(&exclude, "exclude", "skip modules whose name matches this glob (repeatable)")
+	fs.Var(&loaders, "loader", "only extract modules with these loaders, e.g. js,json,wasm")
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: claudeload extract [--beautify] <path>\n")
+		fmt.Fprintf(os.Stderr, "Usage: claudeload extract [--beautify [--beautifier name]] [--from-sourcemaps] [--strict] [-o path] [--format fmt] [--include glob] [--exclude glob] [--loader list] [--jobs n] <path>\n")
+		fmt.Fprintf(os.Stderr, "       claudeload extract --stdout <name|index> <path>\n\n")
+		fmt.Fprintf(os.Stderr, "Globs match module names; * stays within a path segment, ** spans them, and a\n")
+		fmt.Fprintf(os.Stderr, "glob without a slash matches the file name, e.g. --include '*.js'.\n")
+		fmt.Fprintf(os.Stderr, "Archive entries carry their module name as a comment (a PAX record in tar).\n\n")
 		fs.PrintDefaults()
 	}
-	fs.Parse(args)
-	if fs.NArg() < 1 {
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 1 {
 		fs.Usage()
 		os.Exit(1)
 	}
-	exePath := normalizePath(fs.Arg(0))
-	opts := bunfmt.ExtractOptions{Beautify: *beautify, Verbose: verbose}
-	if err := bunfmt.ExtractBunExe(exePath, opts); err != nil {
+	exePath := normalizePath(pos[0])
+
+	if *stdout != "" {
+		var conflicts []string
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name != "stdout" && f.Name != "strict" {
+				conflicts = append(conflicts, "-"+f.Name)
+			}
+		})
+		if len(conflicts) > 0 {
+			fmt.Fprintf(os.Stderr, "[!] --stdout cannot be combined with %s\n", strings.Join(conflicts, ", "))
+			os.Exit(1)
+		}
+		if err := extractToStdout(exePath, *stdout, *strict); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *format == "tgz" {
+		*format = "tar.gz"
+	}
+	if *format != "" && !slices.Contains(bunfmt.ExtractFormats, *format) {
+		fmt.Fprintf(os.Stderr, "[!] --format must be one of %s, not %q\n", strings.Join(bunfmt.ExtractFormats, ", "), *format)
+		os.Exit(1)
+	}
+
+	if !slices.Contains(bunfmt.Beautifiers, *beautifier) {
+		fmt.Fprintf(os.Stderr, "[!] --beautifier must be one of %s, not %q\n", strings.Join(bunfmt.Beautifiers, ", "), *beautifier)
+		os.Exit(1)
+	}
+
+	opts := bunfmt.ExtractOptions{
+		Beautify:   *beautify,
+		Beautifier: *beautifier,
+		Strict:     *strict,
+		Verbose:    verbose,
+		OutputDir:  *outputDir,
+		Format:     *format,
+		Filter:     bunfmt.ModuleFilter{Include: include, Exclude: exclude},
+		Jobs:       *jobs,
+
+		FromSourceMaps: *fromSourceMaps,
+	}
+	for _, name := range loaders.split() {
+		l, ok := bunfmt.LoaderByName(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "[!] unknown loader %q\n", name)
+			os.Exit(1)
+		}
+		opts.Filter.Loaders = append(opts.Filter.Loaders, l)
+	}
+	if err := opts.Filter.Compile(); err != nil {
 		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
 		os.Exit(1)
 	}
+	if err := bunfmt.ExtractBunExe(exePath, opts); err != nil {
+		var verr *bunfmt.ValidationError
+		var perr *bunfmt.PartialExtractError
+		switch {
+		case errors.As(err, &verr):
+			printValidationErrors(err)
+		case errors.As(err, &perr):
+			fmt.Fprintf(os.Stderr, "[!] %v:\n", err)
+			for _, p := range perr.Problems {
+				fmt.Fprintf(os.Stderr, "    - %v\n", p)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// extractToStdout writes the contents of the module ref selects to stdout.
+// Nothing else may be printed there, so the loader runs quietly.
+func extractToStdout(exePath, ref string, strict bool) error {
+	exe, err := bunfmt.LoadExecutable(exePath, false)
+	if err != nil {
+		return err
+	}
+	defer exe.Close()
+	if strict {
+		if err := exe.Validate(); err != nil {
+			printValidationErrors(err)
+			return fmt.Errorf("refusing to extract from an executable that failed validation")
+		}
+	}
+	mod, _, err := selectModule(exe, ref)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(exe.GetModuleContent(mod))
+	return err
+}
+
+// stringList is a flag that may be repeated; each use adds a value.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// split returns the values with comma-separated lists expanded.
+func (l stringList) split() []string {
+	var out []string
+	for _, v := range l {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
 }
 
 func runPluginCmd(args []string) {
@@ -181,7 +367,7 @@ func pluginList() {
 		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
 		os.Exit(1)
 	}
-	entries, err := os.ReadDir(dir)
+	plugins, err := listPlugins(dir)
 	if os.IsNotExist(err) {
 		fmt.Printf("[*] Plugin directory does not exist: %s\n", dir)
 		fmt.Printf("[*] Run claudeload install first.\n")
@@ -191,12 +377,6 @@ func pluginList() {
 		fmt.Fprintf(os.Stderr, "[!] failed to read plugin directory: %v\n", err)
 		os.Exit(1)
 	}
-	var plugins []string
-	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(e.Name(), ".js") {
-			plugins = append(plugins, e.Name())
-		}
-	}
 	if len(plugins) == 0 {
 		fmt.Printf("[*] No plugins installed in %s\n", dir)
 		return
@@ -207,6 +387,22 @@ func pluginList() {
 	}
 }
 
+// listPlugins returns the names of the .js files in dir, which is how the
+// payload decides what to load.
+func listPlugins(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var plugins []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".js") {
+			plugins = append(plugins, e.Name())
+		}
+	}
+	return plugins, nil
+}
+
 func pluginAdd(src string) {
 	dir, err := resolvePluginDir()
 	if err != nil {
@@ -256,7 +452,50 @@ func pluginRemove(name string) {
 	fmt.Printf("[*] Removed plugin: %s\n", name)
 }
 
-func runInstall(exePath string) {
+// installOptions adjusts runInstall for callers other than the install
+// command.
+type installOptions struct {
+	// anchorsPath overrides the user anchor file.
+	anchorsPath string
+	// module selects the module to patch as for selectModule; empty means
+	// the entry point.
+	module string
+	// dryRun prints what install would do instead of doing it.
+	dryRun bool
+	// keepBytecode refuses to patch a bytecode-backed module instead of
+	// stripping its bytecode.
+	keepBytecode bool
+	// discardBackup deletes an existing backup instead of restoring it, for
+	// when it belongs to an older release than the binary being patched.
+	// Without it a backup left behind by an update is refused.
+	discardBackup bool
+}
+
+func runInstallCmd(args []string) {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	anchorsPath := fs.String("anchors", "", "patch anchor file to merge over the built-in anchors (default: user config dir)")
+	module := fs.String("module", "", "module to patch, by index or name (default: the entry point)")
+	dryRun := fs.Bool("dry-run", false, "show the patch and the files install would change without touching disk")
+	bytecode := fs.String("bytecode", "strip", "what to do if the module has precompiled bytecode: strip or refuse")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload install [--dry-run] [--anchors file] [--module name|index] [--bytecode strip|refuse] [<path>]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *bytecode != "strip" && *bytecode != "refuse" {
+		fmt.Fprintf(os.Stderr, "[!] --bytecode must be strip or refuse, not %q\n", *bytecode)
+		os.Exit(1)
+	}
+	exePath := resolveClaudePath(fs.Args())
+	runInstall(exePath, installOptions{
+		anchorsPath:  *anchorsPath,
+		module:       *module,
+		dryRun:       *dryRun,
+		keepBytecode: *bytecode == "refuse",
+	})
+}
+
+func runInstall(exePath string, opts installOptions) {
 	st, err := os.Stat(exePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
@@ -264,93 +503,171 @@ func runInstall(exePath string) {
 	}
 	mode := st.Mode()
 
-	backupPath := exePath + ".original"
-	if backupBytes, err := os.ReadFile(backupPath); err == nil {
-		logv("[*] Existing backup found — restoring original before patching\n")
-		if err := writeFileWithPermHint(exePath, backupBytes, mode); err != nil {
-			fmt.Fprintf(os.Stderr, "[!] failed to restore from backup: %v\n", err)
+	if opts.dryRun {
+		plan, err := planInstall(exePath, opts)
+		if err != nil {
+			printPlanError(err)
+			os.Exit(1)
+		}
+		defer plan.close()
+		if err := plan.printDryRun(); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
 			os.Exit(1)
 		}
+		return
 	}
 
-	exe, err := bunfmt.LoadExecutable(exePath, verbose)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
-		os.Exit(1)
-	}
+	tx, stopSignals := beginTx(exePath)
 
-	mod, err := exe.GetModule(0)
+	plan, err := planInstall(exePath, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
-		os.Exit(1)
+		printPlanError(err)
+		abortTx(tx, "Cannot patch %s.", exePath)
 	}
-
-	content := exe.GetModuleContent(mod)
-	logv("[*] Module: %s  (%d bytes, loader=%s, encoding=%s)\n",
-		exe.GetModuleName(mod), len(content),
-		bunfmt.LoaderExtension[mod.Loader], bunfmt.EncodingName[mod.Encoding])
-
-	licenseIdx := bytes.Index(content, licenseText)
-	if licenseIdx < 0 {
-		fmt.Fprintln(os.Stderr, "[!] License text not found in module content. Cannot patch.")
-		os.Exit(1)
+	defer plan.close()
+	exe, mod, match := plan.exe, plan.mod, plan.match
+	backupPath := plan.backupPath
+	fmt.Printf("[*] Patch anchor: %s in %s (offset %d, %d bytes replaceable)\n", match.Anchor.Name, exe.GetModuleName(mod), match.Offset, match.Space)
+	if plan.stripBytecode {
+		fmt.Printf("[*] Stripping precompiled bytecode from %s so the patched source runs\n", exe.GetModuleName(mod))
 	}
-	logv("[*] License text found at offset %d\n", licenseIdx)
-
-	if len(payloadData) > len(licenseText) {
-		fmt.Fprintln(os.Stderr, "[!] Payload is larger than license text. Cannot patch without shifting offsets.")
-		os.Exit(1)
+	if plan.sourceMapErr != nil {
+		fmt.Fprintf(os.Stderr, "[!] Source map not updated, stack traces may be off: %v\n", plan.sourceMapErr)
+	} else if plan.sourceMap != nil {
+		logv("[*] Updated source map for the patch\n")
+	}
+	if plan.editsModules() {
+		logv("[*] Redoing module edits: %d embedded, %d replaced, %d removed\n", len(plan.carry), len(plan.replace), len(plan.remove))
+	}
+	for _, e := range plan.lostEdits {
+		fmt.Fprintf(os.Stderr, "[!] Dropping %s; the module edit no longer applies to %s.\n", e, exePath)
 	}
 
-	patched := make([]byte, len(content))
-	copy(patched, content)
-	copy(patched[licenseIdx:], bytes.Repeat([]byte{' '}, len(licenseText)))
-	copy(patched[licenseIdx:], payloadData)
+	prev, err := readManifest(exePath)
+	if err != nil && !os.IsNotExist(err) {
+		logv("[*] Ignoring unreadable manifest: %v\n", err)
+	}
 
-	original, err := os.ReadFile(exePath)
+	originalSum, err := fileSHA256(plan.srcPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
-		os.Exit(1)
+		abortTx(tx, "failed to hash executable: %v", err)
 	}
 
-	contentStart := exe.BlobStart + int64(mod.Contents.Offset)
-	contentEnd := contentStart + int64(mod.Contents.Length)
-
-	var out bytes.Buffer
-	out.Write(original[:contentStart])
-	out.Write(patched)
-	out.Write(original[contentEnd:])
-
-	if err := writeFileWithPermHint(backupPath, original, mode); err != nil {
-		fmt.Fprintf(os.Stderr, "[!] failed to write backup: %v\n", err)
-		os.Exit(1)
+	if opts.discardBackup {
+		if err := tx.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+			abortTx(tx, "failed to discard stale backup: %v", permHint(err))
+		}
+		logv("[*] Discarded stale backup %s\n", backupPath)
 	}
-	if err := writeFileWithPermHint(exePath, out.Bytes(), mode); err != nil {
-		fmt.Fprintf(os.Stderr, "[!] failed to write patched executable: %v\n", err)
-		os.Exit(1)
+	if !plan.fromBackup {
+		if err := tx.CopyFile(exePath, backupPath, mode); err != nil {
+			abortTx(tx, "failed to write backup: %v", permHint(err))
+		}
+	}
+	if err := tx.WriteFile(exePath, mode, func(f *os.File) error {
+		return writePatched(f, plan)
+	}); err != nil {
+		abortTx(tx, "failed to write patched executable: %v", permHint(err))
 	}
 
-	payloadDst := filepath.Join(filepath.Dir(exePath), "payload.js")
-	if err := writeFileWithPermHint(payloadDst, embeddedPayload, 0o644); err != nil {
-		fmt.Fprintf(os.Stderr, "[!] failed to write payload.js: %v\n", err)
-		os.Exit(1)
+	if err := tx.WriteFile(plan.payloadPath, 0o644, func(f *os.File) error {
+		_, err := f.Write(embeddedPayload)
+		return err
+	}); err != nil {
+		abortTx(tx, "failed to write payload.js: %v", permHint(err))
 	}
-	logv("[*] Wrote payload.js to %s\n", payloadDst)
+	logv("[*] Wrote payload.js to %s\n", plan.payloadPath)
 
-	pluginDir := filepath.Join(filepath.Dir(exePath), "claudeload-plugins")
-	if err := os.MkdirAll(pluginDir, 0o755); err != nil {
-		fmt.Fprintf(os.Stderr, "[!] failed to create plugin directory: %v\n", err)
-		os.Exit(1)
+	pluginDir := plan.pluginDir
+	_, statErr := os.Stat(pluginDir)
+	createdPluginDir := os.IsNotExist(statErr) || (prev != nil && prev.hasDir(pluginDir))
+	if err := tx.MkdirAll(pluginDir, 0o755); err != nil {
+		abortTx(tx, "failed to create plugin directory: %v", permHint(err))
 	}
 
+	if runtime.GOOS == "darwin" {
+		if err := resignBinary(exePath); err != nil {
+			abortTx(tx, "%v", err)
+		}
+	}
+
+	patchedSum, err := fileSHA256(exePath)
+	if err != nil {
+		abortTx(tx, "failed to hash patched executable: %v", err)
+	}
+	manifest := &installManifest{
+		Version:        version,
+		InstalledAt:    time.Now().UTC(),
+		Executable:     exePath,
+		Backup:         backupPath,
+		OriginalSHA256: originalSum,
+		PatchedSHA256:  patchedSum,
+		Module: manifestModule{
+			Index:  plan.modIdx,
+			Name:   exe.GetModuleName(mod),
+			Anchor: match.Anchor.Name,
+			Offset: match.Offset,
+			Length: len(plan.patch),
+
+			BytecodeStripped: plan.stripBytecode,
+		},
+		Files:    []string{backupPath, plan.payloadPath},
+		Embedded: plan.embedded,
+		Replaced: plan.replaced,
+		Removed:  plan.removed,
+	}
+	if createdPluginDir {
+		manifest.Dirs = []string{pluginDir}
+	}
+	if err := tx.WriteFile(manifestPath(exePath), 0o644, manifest.writeTo); err != nil {
+		abortTx(tx, "failed to write manifest: %v", permHint(err))
+	}
+
+	stopSignals()
+	if err := tx.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] installed, but failed to clean up: %v\n", err)
+	}
 	fmt.Printf("[*] Installed %s\n", exePath)
 	fmt.Printf("[*] Plugin directory: %s\n", pluginDir)
+}
 
-	if runtime.GOOS == "darwin" {
-		if err := resignBinary(exePath); err != nil {
-			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
-			os.Exit(1)
+// writePatched writes the patched executable to out. When the payload fits
+// in the anchor's replaceable space the file is copied and only that range
+// is rewritten, leaving every offset in the blob untouched; otherwise the
+// module graph is re-serialized.
+func writePatched(out *os.File, plan *installPlan) error {
+	exe := plan.exe
+	if plan.inPlace() {
+		if _, err := io.Copy(out, io.NewSectionReader(exe.Src, 0, exe.Src.Size())); err != nil {
+			return err
 		}
+		at := exe.BlobStart + int64(plan.mod.Contents.Offset) + int64(plan.match.Offset)
+		_, err := out.WriteAt(plan.patch, at)
+		return err
+	}
+
+	logv("[*] Re-serializing module graph\n")
+	graph, err := plan.graph()
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	if err := exe.WriteExecutable(w, graph); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// printValidationErrors lists each problem reported by ExecutableData.Validate
+// on its own line.
+func printValidationErrors(err error) {
+	fmt.Fprintln(os.Stderr, "[!] Executable failed validation:")
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "    - %v\n", e)
 	}
 }
 
@@ -370,16 +687,48 @@ func resignBinary(exePath string) error {
 	return lastErr
 }
 
-func runUninstall(exePath string) {
+func runUninstall(args []string) {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	force := fs.Bool("force", false, "restore the backup even if the binary or backup no longer match the install manifest")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload uninstall [--force] [<path>]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	exePath := resolveClaudePath(fs.Args())
+
 	backupPath := exePath + ".original"
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "[!] No backup file found: %s\n", backupPath)
+	payloadPath := filepath.Join(filepath.Dir(exePath), "payload.js")
+	pluginDir := filepath.Join(filepath.Dir(exePath), "claudeload-plugins")
+	files := []string{backupPath, payloadPath}
+	dirs := []string{pluginDir}
+
+	manifest, err := readManifest(exePath)
+	switch {
+	case err == nil:
+		if err := manifest.checkPaths(exePath); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			fmt.Fprintln(os.Stderr, "[!] Refusing to uninstall.")
+			os.Exit(1)
+		}
+		backupPath, files, dirs = manifest.Backup, manifest.Files, manifest.Dirs
+		if err := verifyManifest(manifest, exePath); err != nil {
+			if !*force {
+				fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+				fmt.Fprintln(os.Stderr, "[!] Refusing to restore the backup; re-run with --force to restore it anyway.")
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "[!] %v (continuing because of --force)\n", err)
+		}
+	case os.IsNotExist(err):
+		logv("[*] No install manifest found — assuming default file locations\n")
+	default:
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
 		os.Exit(1)
 	}
 
-	backupBytes, err := os.ReadFile(backupPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "[!] failed to read backup: %v\n", err)
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "[!] No backup file found: %s\n", backupPath)
 		os.Exit(1)
 	}
 
@@ -388,34 +737,40 @@ func runUninstall(exePath string) {
 		mode = fi.Mode()
 	}
 
-	if err := writeFileWithPermHint(exePath, backupBytes, mode); err != nil {
-		fmt.Fprintf(os.Stderr, "[!] failed to restore executable: %v\n", err)
-		os.Exit(1)
+	tx, stopSignals := beginTx(exePath)
+	if err := tx.CopyFile(backupPath, exePath, mode); err != nil {
+		abortTx(tx, "failed to restore executable: %v", permHint(err))
 	}
-	if err := os.Remove(backupPath); err != nil {
-		fmt.Fprintf(os.Stderr, "[!] restored but failed to delete backup: %v\n", err)
-		os.Exit(1)
+
+	for _, f := range files {
+		if err := tx.Remove(f); err != nil && !os.IsNotExist(err) {
+			abortTx(tx, "failed to remove %s: %v", f, permHint(err))
+		}
+		logv("[*] Removed %s\n", f)
 	}
 
-	payloadPath := filepath.Join(filepath.Dir(exePath), "payload.js")
-	if err := os.Remove(payloadPath); err != nil && !os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "[!] failed to remove payload.js: %v\n", err)
-		os.Exit(1)
+	for _, d := range dirs {
+		remaining, _ := os.ReadDir(d)
+		if len(remaining) > 0 {
+			logv("[*] Kept %s (contains user files)\n", d)
+			continue
+		}
+		if err := tx.Remove(d); err != nil && !os.IsNotExist(err) {
+			abortTx(tx, "failed to remove %s: %v", d, permHint(err))
+		}
+		logv("[*] Removed empty directory %s\n", d)
 	}
-	logv("[*] Removed payload.js\n")
 
-	pluginDir := filepath.Join(filepath.Dir(exePath), "claudeload-plugins")
-	remaining, _ := os.ReadDir(pluginDir)
-	if len(remaining) == 0 {
-		if err := os.Remove(pluginDir); err != nil && !os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "[!] failed to remove plugin directory: %v\n", err)
-			os.Exit(1)
+	if manifest != nil {
+		if err := tx.Remove(manifestPath(exePath)); err != nil && !os.IsNotExist(err) {
+			abortTx(tx, "failed to remove manifest: %v", permHint(err))
 		}
-		logv("[*] Removed empty plugin directory\n")
-	} else {
-		logv("[*] Plugin directory kept (contains user files)\n")
 	}
 
+	stopSignals()
+	if err := tx.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] uninstalled, but failed to clean up: %v\n", err)
+	}
 	fmt.Printf("[*] Uninstalled %s\n", exePath)
 }
 
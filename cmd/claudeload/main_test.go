@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		wantAs  string
+		wantRaw bool
+	}{
+		{[]string{"a.js"}, []string{"a.js"}, "", false},
+		{[]string{"--as", "x", "a.js", "claude"}, []string{"a.js", "claude"}, "x", false},
+		{[]string{"a.js", "--as", "x", "claude", "--raw"}, []string{"a.js", "claude"}, "x", true},
+		{[]string{"--raw", "--", "-a.js", "--as"}, []string{"-a.js", "--as"}, "", true},
+		{[]string{"a.js", "--", "-b", "--raw"}, []string{"a.js", "-b", "--raw"}, "", false},
+		{[]string{"--as", "x", "--"}, nil, "x", false},
+		{[]string{"--as", "--", "a.js", "--raw"}, []string{"a.js"}, "--", true},
+		{[]string{"--raw", "--", "--", "a.js"}, []string{"--", "a.js"}, "", true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		as := fs.String("as", "", "")
+		raw := fs.Bool("raw", false, "")
+		got := parseInterspersed(fs, tt.args)
+		if !slices.Equal(got, tt.want) || *as != tt.wantAs || *raw != tt.wantRaw {
+			t.Errorf("parseInterspersed(%q) = %q, as=%q, raw=%t; want %q, %q, %t", tt.args, got, *as, *raw, tt.want, tt.wantAs, tt.wantRaw)
+		}
+	}
+}
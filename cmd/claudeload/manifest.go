@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const manifestName = "claudeload-manifest.json"
+
+// installManifest records what install changed so that uninstall and status
+// can check the binary is still the one we patched before touching it.
+type installManifest struct {
+	Version        string         `json:"claudeload_version"`
+	InstalledAt    time.Time      `json:"installed_at"`
+	Executable     string         `json:"executable"`
+	Backup         string         `json:"backup"`
+	OriginalSHA256 string         `json:"original_sha256"`
+	PatchedSHA256  string         `json:"patched_sha256"`
+	Module         manifestModule `json:"module"`
+	Files          []string       `json:"files"`          // files install created
+	Dirs           []string       `json:"dirs,omitempty"` // directories install created
+
+	// Embedded lists the modules added with embed. Reinstalling from the
+	// backup carries them over from the binary being replaced.
+	Embedded []string `json:"embedded,omitempty"`
+	// Replaced and Removed list modules of the original binary changed with
+	// module replace and module rm; reinstalling from the backup redoes them.
+	Replaced []string `json:"replaced,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// manifestModule locates the injected payload. Offset is relative to the
+// start of the module's contents.
+type manifestModule struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Anchor string `json:"anchor"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+
+	// BytecodeStripped records that the module's precompiled bytecode was
+	// removed so that Bun runs the patched source.
+	BytecodeStripped bool `json:"bytecode_stripped,omitempty"`
+}
+
+func manifestPath(exePath string) string {
+	return filepath.Join(filepath.Dir(exePath), manifestName)
+}
+
+// readManifest loads the manifest for exePath. It returns an error satisfying
+// os.IsNotExist when there is none, e.g. for installs made by older versions,
+// or when the manifest next to exePath describes a different binary.
+func readManifest(exePath string) (*installManifest, error) {
+	m, err := loadManifest(exePath)
+	if err != nil {
+		return nil, err
+	}
+	if m.Executable != exePath {
+		return nil, &os.PathError{Op: "read manifest", Path: exePath, Err: os.ErrNotExist}
+	}
+	return m, nil
+}
+
+// loadManifest loads the manifest in exePath's directory whichever binary it
+// describes, e.g. a previous release that an update has since replaced.
+func loadManifest(exePath string) (*installManifest, error) {
+	data, err := os.ReadFile(manifestPath(exePath))
+	if err != nil {
+		return nil, err
+	}
+	var m installManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", manifestPath(exePath), err)
+	}
+	return &m, nil
+}
+
+func (m *installManifest) writeTo(f *os.File) error {
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// hasDir reports whether install created dir.
+func (m *installManifest) hasDir(dir string) bool {
+	for _, d := range m.Dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkPaths makes sure every path the manifest has uninstall remove or
+// restore from lies in exePath's directory, so that an edited or misplaced
+// manifest cannot direct it at unrelated files. exePath itself is refused too,
+// as removing it would undo the restore.
+func (m *installManifest) checkPaths(exePath string) error {
+	dir := filepath.Dir(exePath)
+	paths := append([]string{m.Backup}, m.Files...)
+	for _, p := range append(paths, m.Dirs...) {
+		rel, err := filepath.Rel(dir, p)
+		inside := err == nil && filepath.IsAbs(p) && rel != "." &&
+			rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		if !inside || filepath.Clean(p) == filepath.Clean(exePath) {
+			return fmt.Errorf("manifest %s lists %q, which is not a file install created next to %s", manifestPath(exePath), p, exePath)
+		}
+	}
+	return nil
+}
+
+// verifyManifest checks that exePath is still the binary install produced
+// and that the backup is still the binary it replaced.
+func verifyManifest(m *installManifest, exePath string) error {
+	sum, err := fileSHA256(exePath)
+	if err != nil {
+		return err
+	}
+	if sum != m.PatchedSHA256 {
+		return fmt.Errorf("%s has changed since it was patched (sha256 %s, expected %s)", exePath, sum, m.PatchedSHA256)
+	}
+	sum, err = fileSHA256(m.Backup)
+	if err != nil {
+		return err
+	}
+	if sum != m.OriginalSHA256 {
+		return fmt.Errorf("backup %s does not match the original binary (sha256 %s, expected %s)", m.Backup, sum, m.OriginalSHA256)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeInstall lays out what install leaves behind in dir: a patched
+// binary, its backup, payload.js and a manifest describing them. It returns
+// the binary's path and the manifest.
+func writeInstall(t *testing.T, dir string) (string, *installManifest) {
+	t.Helper()
+	exePath := filepath.Join(dir, "claude")
+	files := map[string]string{
+		exePath:                          "patched",
+		exePath + ".original":            "original",
+		filepath.Join(dir, "payload.js"): "payload",
+	}
+	for path, contents := range files {
+		if err := os.WriteFile(path, []byte(contents), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &installManifest{
+		Version:     version,
+		InstalledAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Executable:  exePath,
+		Backup:      exePath + ".original",
+		Module:      manifestModule{Index: 0, Name: "/$bunfs/root/cli.js", Anchor: "after-import", Offset: 10, Length: 20},
+		Files:       []string{exePath + ".original", filepath.Join(dir, "payload.js")},
+		Dirs:        []string{filepath.Join(dir, "claudeload-plugins")},
+	}
+	var err error
+	if m.PatchedSHA256, err = fileSHA256(exePath); err != nil {
+		t.Fatal(err)
+	}
+	if m.OriginalSHA256, err = fileSHA256(m.Backup); err != nil {
+		t.Fatal(err)
+	}
+	saveManifest(t, exePath, m)
+	return exePath, m
+}
+
+func saveManifest(t *testing.T, exePath string, m *installManifest) {
+	t.Helper()
+	f, err := os.Create(manifestPath(exePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := m.writeTo(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, exePath string)
+		wantErr string
+	}{
+		{"untouched", func(t *testing.T, exePath string) {}, ""},
+		{"binary replaced", func(t *testing.T, exePath string) {
+			os.WriteFile(exePath, []byte("updated"), 0o755)
+		}, "has changed since it was patched"},
+		{"backup replaced", func(t *testing.T, exePath string) {
+			os.WriteFile(exePath+".original", []byte("other"), 0o755)
+		}, "does not match the original binary"},
+		{"backup missing", func(t *testing.T, exePath string) {
+			os.Remove(exePath + ".original")
+		}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exePath, want := writeInstall(t, t.TempDir())
+			got, err := readManifest(exePath)
+			if err != nil {
+				t.Fatalf("readManifest: %v", err)
+			}
+			if got.Backup != want.Backup || got.PatchedSHA256 != want.PatchedSHA256 ||
+				got.Module != want.Module || !got.InstalledAt.Equal(want.InstalledAt) ||
+				strings.Join(got.Files, ",") != strings.Join(want.Files, ",") || !got.hasDir(want.Dirs[0]) {
+				t.Fatalf("readManifest = %+v, want %+v", got, want)
+			}
+
+			tt.tamper(t, exePath)
+			err = verifyManifest(got, exePath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("verifyManifest: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyManifest = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifestCheckPaths(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		edit func(m *installManifest, exePath string)
+		ok   bool
+	}{
+		{"as installed", func(m *installManifest, exePath string) {}, true},
+		{"file in a subdirectory", func(m *installManifest, exePath string) {
+			m.Files = append(m.Files, filepath.Join(dir, "claudeload-plugins", "x.js"))
+		}, true},
+		{"file elsewhere", func(m *installManifest, exePath string) {
+			m.Files = append(m.Files, "/etc/passwd")
+		}, false},
+		{"file escaping the directory", func(m *installManifest, exePath string) {
+			m.Files = append(m.Files, filepath.Join(dir, "..", "x"))
+		}, false},
+		{"relative file", func(m *installManifest, exePath string) {
+			m.Files = append(m.Files, "payload.js")
+		}, false},
+		{"the binary itself", func(m *installManifest, exePath string) {
+			m.Files = append(m.Files, exePath)
+		}, false},
+		{"backup elsewhere", func(m *installManifest, exePath string) {
+			m.Backup = filepath.Join(os.TempDir(), "claude.original")
+		}, false},
+		{"the directory itself", func(m *installManifest, exePath string) {
+			m.Dirs = append(m.Dirs, dir)
+		}, false},
+		{"directory elsewhere", func(m *installManifest, exePath string) {
+			m.Dirs = append(m.Dirs, filepath.Dir(dir))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exePath, m := writeInstall(t, dir)
+			tt.edit(m, exePath)
+			if err := m.checkPaths(exePath); (err == nil) != tt.ok {
+				t.Errorf("checkPaths = %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"claudeload/internal/bunfmt"
+)
+
+// selectModule resolves a --module argument: an index, a full module name,
+// or a unique suffix of one such as "worker.js". An empty ref selects the
+// graph's entry point.
+func selectModule(exe *bunfmt.ExecutableData, ref string) (bunfmt.ModuleStruct, int, error) {
+	if ref == "" {
+		idx := int(exe.Offsets.EntryPointID)
+		m, err := exe.GetModule(idx)
+		return m, idx, err
+	}
+	if idx, err := strconv.Atoi(ref); err == nil {
+		if idx < 0 || idx >= exe.NumModules {
+			return bunfmt.ModuleStruct{}, -1, fmt.Errorf("module index %d out of range [0, %d)", idx, exe.NumModules)
+		}
+		m, err := exe.GetModule(idx)
+		return m, idx, err
+	}
+	if m, idx, err := exe.FindModuleByName(ref); err == nil {
+		return m, idx, nil
+	}
+
+	var found []int
+	var names []string
+	for i := 0; i < exe.NumModules; i++ {
+		m, err := exe.GetModule(i)
+		if err != nil {
+			return bunfmt.ModuleStruct{}, -1, err
+		}
+		if name := exe.GetModuleName(m); strings.HasSuffix(name, "/"+ref) || strings.HasSuffix(name, `\`+ref) {
+			found = append(found, i)
+			names = append(names, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return bunfmt.ModuleStruct{}, -1, fmt.Errorf("module %q not found", ref)
+	case 1:
+		m, err := exe.GetModule(found[0])
+		return m, found[0], err
+	}
+	return bunfmt.ModuleStruct{}, -1, fmt.Errorf("module %q is ambiguous: %s", ref, strings.Join(names, ", "))
+}
+
+func runModuleCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "[!] Usage: claudeload module <replace|rm> [args]")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "replace":
+		runModuleReplace(args[1:])
+	case "rm":
+		runModuleRemove(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "[!] Unknown module command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func runModuleReplace(args []string) {
+	fs := flag.NewFlagSet("module replace", flag.ExitOnError)
+	sourceMap := fs.String("sourcemap", "", "source map for the new contents (default: drop the module's source map)")
+	editOpts := addEditFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload module replace [--sourcemap file] [-o out | --no-backup] <name|index> <file> [<path>]\n")
+		fs.PrintDefaults()
+	}
+	pos := parseInterspersed(fs, args)
+	if len(pos) < 2 || len(pos) > 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	ref, file := pos[0], pos[1]
+	exePath := resolveClaudePath(pos[2:])
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	var sm []byte
+	if *sourceMap != "" {
+		if sm, err = os.ReadFile(*sourceMap); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var name string
+	written := editGraph(exePath, *editOpts, func(exe *bunfmt.ExecutableData, g *bunfmt.Graph, m *installManifest) error {
+		mod, idx, err := selectEditable(exe, ref, m)
+		if err != nil {
+			return err
+		}
+		name = exe.GetModuleName(mod)
+		if err := g.ReplaceContents(idx, data, sm); err != nil {
+			return err
+		}
+		fmt.Printf("[*] Replacing [%d] %s (%d -> %d bytes)\n", idx, name, mod.Contents.Length, len(data))
+		if hasBytecode(mod) {
+			fmt.Printf("[*] Dropping its precompiled bytecode so the new contents run\n")
+		}
+		if !slices.Contains(m.Embedded, name) && !slices.Contains(m.Replaced, name) {
+			m.Replaced = append(m.Replaced, name)
+		}
+		return nil
+	})
+	fmt.Printf("[*] Replaced %s in %s\n", name, written)
+}
+
+func runModuleRemove(args []string) {
+	fs := flag.NewFlagSet("module rm", flag.ExitOnError)
+	editOpts := addEditFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload module rm [-o out | --no-backup] <name|index> [<path>]\n")
+		fs.PrintDefaults()
+	}
+	pos := parseInterspersed(fs, args)
+	if len(pos) < 1 || len(pos) > 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	ref := pos[0]
+	exePath := resolveClaudePath(pos[1:])
+
+	var name string
+	written := editGraph(exePath, *editOpts, func(exe *bunfmt.ExecutableData, g *bunfmt.Graph, m *installManifest) error {
+		_, idx, err := selectEditable(exe, ref, m)
+		if err != nil {
+			return err
+		}
+		name = g.Files[idx].Name
+		if err := g.RemoveFile(idx); err != nil {
+			return err
+		}
+		fmt.Printf("[*] Removing [%d] %s\n", idx, name)
+		if slices.Contains(m.Embedded, name) {
+			m.Embedded = slices.DeleteFunc(m.Embedded, func(e string) bool { return e == name })
+			return nil
+		}
+		m.Replaced = slices.DeleteFunc(m.Replaced, func(e string) bool { return e == name })
+		m.Removed = append(m.Removed, name)
+		return nil
+	})
+	fmt.Printf("[*] Removed %s from %s\n", name, written)
+}
+
+// selectEditable resolves ref like selectModule but refuses the module that
+// carries the payload: reinstalling would patch the original module and then
+// lose the payload to the edit.
+func selectEditable(exe *bunfmt.ExecutableData, ref string, m *installManifest) (bunfmt.ModuleStruct, int, error) {
+	if ref == "" {
+		return bunfmt.ModuleStruct{}, -1, fmt.Errorf("no module given")
+	}
+	mod, idx, err := selectModule(exe, ref)
+	if err != nil {
+		return mod, idx, err
+	}
+	if name := exe.GetModuleName(mod); m.Module.Name != "" && name == m.Module.Name {
+		return mod, idx, fmt.Errorf("module %s carries the claudeload payload; uninstall first to change it", name)
+	}
+	return mod, idx, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"claudeload/internal/bunfmt"
+)
+
+// testGraph is a small graph of the shape claude ships: the entry point is
+// not module 0, and two modules share a base name.
+func testGraph() *bunfmt.Graph {
+	return &bunfmt.Graph{
+		EntryPointID: 1,
+		Files: []bunfmt.GraphFile{
+			bunfmt.NewGraphFile("/$bunfs/root/worker.js", []byte("self.onmessage = () => {};\n")),
+			bunfmt.NewGraphFile("/$bunfs/root/cli.js", []byte("// Version: 2.0.14\nimport {a} from './a.js';\nconsole.log(a);\n")),
+			bunfmt.NewGraphFile("/$bunfs/root/vendor/util.js", []byte("export const a = 1;\n")),
+			bunfmt.NewGraphFile("/$bunfs/root/lib/util.js", []byte("export const b = 2;\n")),
+		},
+	}
+}
+
+// writeExe writes g to dir/claude laid out the way bun build --compile
+// appends it, and returns the path.
+func writeExe(t *testing.T, dir string, g *bunfmt.Graph) string {
+	t.Helper()
+	blob, offsets, err := g.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	out := append([]byte("runtime Bun v1.3.2"), blob...)
+	out = append(out, bunfmt.LatestLayout.OffsetsBytes(offsets)...)
+	out = append(out, bunfmt.Trailer...)
+	out = binary.LittleEndian.AppendUint64(out, uint64(len(out)+8))
+	path := filepath.Join(dir, "claude")
+	if err := os.WriteFile(path, out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadExe loads the executable at path, closing it when the test ends.
+func loadExe(t *testing.T, path string) *bunfmt.ExecutableData {
+	t.Helper()
+	exe, err := bunfmt.LoadExecutable(path, false)
+	if err != nil {
+		t.Fatalf("LoadExecutable: %v", err)
+	}
+	t.Cleanup(func() { exe.Close() })
+	return exe
+}
+
+func TestSelectModule(t *testing.T) {
+	exe := loadExe(t, writeExe(t, t.TempDir(), testGraph()))
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr string
+	}{
+		{"", 1, ""},
+		{"0", 0, ""},
+		{"3", 3, ""},
+		{"4", 0, "out of range"},
+		{"-1", 0, "out of range"},
+		{"/$bunfs/root/worker.js", 0, ""},
+		{"worker.js", 0, ""},
+		{"vendor/util.js", 2, ""},
+		{"util.js", 0, "ambiguous"},
+		{"ker.js", 0, "not found"},
+		{"missing.js", 0, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			m, idx, err := selectModule(exe, tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("selectModule(%q) error = %v, want %q", tt.ref, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectModule(%q): %v", tt.ref, err)
+			}
+			if idx != tt.want {
+				t.Errorf("selectModule(%q) = module %d, want %d", tt.ref, idx, tt.want)
+			}
+			if want := testGraph().Files[tt.want].Name; exe.GetModuleName(m) != want {
+				t.Errorf("selectModule(%q) returned %s, want %s", tt.ref, exe.GetModuleName(m), want)
+			}
+		})
+	}
+}
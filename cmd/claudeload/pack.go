@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"claudeload/internal/bunfmt"
+)
+
+func runPack(args []string) {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	basePath := fs.String("base", "", "executable the directory was extracted from; its runtime and layout are reused")
+	outPath := fs.String("o", "", "where to write the packed executable")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload pack --base <exe> -o <out> <extracted_dir>\n")
+		fs.PrintDefaults()
+	}
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 1 || *basePath == "" || *outPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	dir := pos[0]
+	if st, err := os.Stat(dir); err == nil && !st.IsDir() {
+		fmt.Fprintf(os.Stderr, "[!] %s is not a directory; unpack the archive and pack the directory instead.\n", dir)
+		os.Exit(1)
+	}
+
+	base, err := bunfmt.LoadExecutable(normalizePath(*basePath), verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	defer base.Close()
+	if err := base.Validate(); err != nil {
+		printPlanError(err)
+		os.Exit(1)
+	}
+	bg, err := base.Graph()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+
+	g, err := bunfmt.LoadExtracted(dir, bg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	if g.Layout != nil && g.Layout != base.Layout {
+		fmt.Fprintf(os.Stderr, "[!] %s was extracted from a %s graph but %s uses %s; packing as %s\n",
+			dir, g.Layout.Name, *basePath, base.Layout.Name, base.Layout.Name)
+	}
+	g.Layout = base.Layout
+
+	if err := dropStale(g, bg); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+
+	st, err := os.Stat(*basePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	if out, err := os.Stat(*outPath); err == nil && os.SameFile(st, out) {
+		fmt.Fprintln(os.Stderr, "[!] -o must not be the base executable; pack into a new file and move it over the original.")
+		os.Exit(1)
+	}
+	if err := writeExecutableFile(*outPath, st.Mode(), base, g); err != nil {
+		fmt.Fprintf(os.Stderr, "[!] failed to write %s: %v\n", *outPath, permHint(err))
+		os.Exit(1)
+	}
+	if runtime.GOOS == "darwin" {
+		if err := resignBinary(*outPath); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("[*] Packed %d modules from %s into %s\n", len(g.Files), dir, *outPath)
+}
+
+// dropStale discards what no longer matches a module's edited contents: its
+// bytecode and module info, which Bun would run instead of the edit, and its
+// source map unless that was edited too. Modules are matched to bg, the
+// base executable's graph, by name.
+func dropStale(g, bg *bunfmt.Graph) error {
+	for i := range g.Files {
+		f := &g.Files[i]
+		j := bg.FileIndex(f.Name)
+		if j < 0 {
+			logv("[*] %s is new\n", f.Name)
+			continue
+		}
+		old := &bg.Files[j]
+		if bytes.Equal(f.Contents, old.Contents) {
+			continue
+		}
+		sm := f.SourceMap
+		if bytes.Equal(sm, old.SourceMap) {
+			sm = nil
+		}
+		fmt.Printf("[*] %s was edited", f.Name)
+		if len(f.Bytecode) > 0 {
+			fmt.Printf("; dropping its bytecode")
+		}
+		if len(f.SourceMap) > 0 && sm == nil {
+			fmt.Printf("; dropping its stale source map")
+		}
+		fmt.Println()
+		if err := g.ReplaceContents(i, f.Contents, sm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeExecutableFile writes exe with its graph replaced by g to path,
+// through a temporary file so that a failed write leaves path untouched.
+func writeExecutableFile(path string, mode os.FileMode, exe *bunfmt.ExecutableData, g *bunfmt.Graph) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	if err := exe.WriteExecutable(w, g); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode.Perm()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
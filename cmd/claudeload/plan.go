@@ -0,0 +1,506 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"claudeload/internal/anchor"
+	"claudeload/internal/bunfmt"
+	"claudeload/internal/sourcemap"
+)
+
+// installPlan is everything install decides before it touches the disk.
+type installPlan struct {
+	exePath     string
+	srcPath     string // binary the patch is applied to: exePath or its backup
+	backupPath  string
+	fromBackup  bool // srcPath is an existing backup, i.e. a reinstall
+	payloadPath string
+	pluginDir   string
+
+	exe    *bunfmt.ExecutableData
+	mod    bunfmt.ModuleStruct
+	modIdx int
+	match  anchor.Match
+	patch  []byte // bytes that replace match.Space bytes at match.Offset
+
+	// stripBytecode is set when the module carries precompiled bytecode,
+	// which Bun would run instead of the patched source.
+	stripBytecode bool
+
+	// sourceMap is the module's source map updated for the patch, or nil if
+	// the map is unchanged. sourceMapErr says why it could not be updated.
+	sourceMap    []byte
+	sourceMapErr error
+
+	// Module edits made with embed, module replace and module rm that the
+	// patched binary keeps, as recorded in the manifest. A backup predates
+	// them, so patching it redoes them: carry and replace are read from
+	// current, the binary being replaced, and remove names modules to drop.
+	// lostEdits describes edits that cannot be redone.
+	embedded, replaced, removed []string
+	carry, replace              []bunfmt.GraphFile
+	remove                      []string
+	current                     *bunfmt.ExecutableData
+	lostEdits                   []string
+}
+
+// payloadSourceName is the synthetic source the payload maps to in patched
+// source maps.
+const payloadSourceName = "claudeload-payload.js"
+
+// errBytecode explains why a bytecode-backed module is not patched with
+// --bytecode refuse.
+var errBytecode = errors.New("module has precompiled bytecode: Bun runs the bytecode instead of the source, so the patch would have no effect\n" +
+	"  hint: re-run with --bytecode strip to remove the bytecode (startup may be slower)")
+
+// planInstall loads the binary install would patch and locates the patch
+// site. A reinstall patches the backup rather than the already patched
+// binary, unless opts.discardBackup says the backup is stale; a backup left
+// behind by an update is refused rather than patched.
+func planInstall(exePath string, opts installOptions) (*installPlan, error) {
+	dir := filepath.Dir(exePath)
+	p := &installPlan{
+		exePath:     exePath,
+		srcPath:     exePath,
+		backupPath:  exePath + ".original",
+		payloadPath: filepath.Join(dir, "payload.js"),
+		pluginDir:   filepath.Join(dir, "claudeload-plugins"),
+	}
+	if !opts.discardBackup && fileExists(p.backupPath) {
+		if err := checkBackupCurrent(exePath, p.backupPath, opts.module); err != nil {
+			return nil, err
+		}
+		logv("[*] Existing backup found — patching the original from %s\n", p.backupPath)
+		p.srcPath, p.fromBackup = p.backupPath, true
+	}
+
+	exe, err := bunfmt.LoadExecutable(p.srcPath, verbose)
+	if err != nil {
+		return nil, err
+	}
+	p.exe = exe
+	if err := exe.Validate(); err != nil {
+		exe.Close()
+		return nil, err
+	}
+
+	p.mod, p.modIdx, err = selectModule(exe, opts.module)
+	if err != nil {
+		exe.Close()
+		return nil, err
+	}
+	name := exe.GetModuleName(p.mod)
+	if hasBytecode(p.mod) {
+		if opts.keepBytecode {
+			exe.Close()
+			return nil, fmt.Errorf("%s: %w", name, errBytecode)
+		}
+		p.stripBytecode = true
+	}
+	content := exe.GetModuleContent(p.mod)
+	logv("[*] Module [%d]: %s  (%d bytes, loader=%s, encoding=%s)\n",
+		p.modIdx, name, len(content),
+		bunfmt.LoaderExtension[p.mod.Loader], bunfmt.EncodingName[p.mod.Encoding])
+
+	anchors, err := loadAnchors(opts.anchorsPath)
+	if err != nil {
+		exe.Close()
+		return nil, err
+	}
+	p.match, err = anchor.Find(anchors, content)
+	if errors.Is(err, anchor.ErrNoMatch) {
+		exe.Close()
+		return nil, fmt.Errorf("no patch anchor found in %s", name)
+	}
+	if err != nil {
+		exe.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	p.patch = p.match.Patch(payloadData)
+
+	if err := p.planModuleEdits(); err != nil {
+		p.close()
+		return nil, err
+	}
+
+	// In-place patches move nothing, so the existing mappings stay valid.
+	if !p.inPlace() && p.mod.SourceMap.Length > 0 {
+		p.sourceMap, p.sourceMapErr = p.patchSourceMap(content)
+	}
+	return p, nil
+}
+
+// checkBackupCurrent makes sure backupPath is still the original of the
+// binary at exePath. Once Claude Code has updated itself the backup belongs
+// to the previous release, and patching it would silently downgrade.
+func checkBackupCurrent(exePath, backupPath, moduleRef string) error {
+	sum, err := fileSHA256(exePath)
+	if err != nil {
+		return err
+	}
+	if m, err := readManifest(exePath); err == nil {
+		if sum == m.PatchedSHA256 {
+			return nil
+		}
+	} else {
+		// Installs made before the manifest existed can only be recognised
+		// by the payload.
+		probe, err := probePatch(exePath, moduleRef)
+		if err != nil {
+			return err
+		}
+		if probe.patched {
+			return nil
+		}
+	}
+	backupSum, err := fileSHA256(backupPath)
+	if err != nil {
+		return err
+	}
+	if sum == backupSum {
+		// The original was restored by hand.
+		return nil
+	}
+	return fmt.Errorf("%s has changed since it was patched, so the backup %s belongs to an older release\n"+
+		"  hint: run 'claudeload ensure' to discard the stale backup and patch the current binary", exePath, backupPath)
+}
+
+// planModuleEdits works out which module edits the patched binary keeps and
+// what it takes to redo them.
+func (p *installPlan) planModuleEdits() error {
+	m, err := readManifest(p.exePath)
+	if err != nil {
+		return nil
+	}
+	has := func(name string) bool {
+		_, _, err := p.exe.FindModuleByName(name)
+		return err == nil
+	}
+
+	var fromCurrent []string
+	for _, name := range m.Embedded {
+		switch {
+		case has(name):
+			p.embedded = append(p.embedded, name)
+		case p.fromBackup:
+			fromCurrent = append(fromCurrent, name)
+		default:
+			p.lostEdits = append(p.lostEdits, "embedded module "+name)
+		}
+	}
+	for _, name := range m.Replaced {
+		switch {
+		case !has(name):
+			p.lostEdits = append(p.lostEdits, "replaced module "+name+" (no longer in the binary)")
+		case p.fromBackup:
+			fromCurrent = append(fromCurrent, name)
+		default:
+			p.lostEdits = append(p.lostEdits, "replacement of "+name)
+		}
+	}
+	for _, name := range m.Removed {
+		switch {
+		case !has(name):
+			p.removed = append(p.removed, name)
+		case p.fromBackup:
+			p.remove = append(p.remove, name)
+			p.removed = append(p.removed, name)
+		default:
+			p.lostEdits = append(p.lostEdits, "removal of "+name)
+		}
+	}
+	if len(fromCurrent) == 0 {
+		return nil
+	}
+
+	cur, err := bunfmt.LoadExecutable(p.exePath, verbose)
+	if err != nil {
+		return fmt.Errorf("reading edited modules from %s: %w", p.exePath, err)
+	}
+	p.current = cur
+	g, err := cur.Graph()
+	if err != nil {
+		return fmt.Errorf("reading edited modules from %s: %w", p.exePath, err)
+	}
+	for _, name := range fromCurrent {
+		i := g.FileIndex(name)
+		switch {
+		case i < 0:
+			p.lostEdits = append(p.lostEdits, "module "+name+" (missing from "+p.exePath+")")
+		case slices.Contains(m.Embedded, name):
+			p.carry = append(p.carry, g.Files[i])
+			p.embedded = append(p.embedded, name)
+		default:
+			p.replace = append(p.replace, g.Files[i])
+			p.replaced = append(p.replaced, name)
+		}
+	}
+	return nil
+}
+
+// editsModules reports whether the patch redoes module edits.
+func (p *installPlan) editsModules() bool {
+	return len(p.carry)+len(p.replace)+len(p.remove) > 0
+}
+
+func (p *installPlan) patchSourceMap(content []byte) ([]byte, error) {
+	sm, err := p.exe.ReadPointer(p.mod.SourceMap)
+	if err != nil {
+		return nil, err
+	}
+	edit := sourcemap.Edit{Offset: p.match.Offset, Length: p.match.Space, Text: p.patch}
+	return sourcemap.Patch(sm, content, edit, payloadSourceName)
+}
+
+func (p *installPlan) close() {
+	p.exe.Close()
+	if p.current != nil {
+		p.current.Close()
+	}
+}
+
+// inPlace reports whether the binary can be patched by overwriting the patch
+// site alone, without re-serializing the graph.
+func (p *installPlan) inPlace() bool {
+	return len(p.patch) == p.match.Space && !p.stripBytecode && !p.editsModules()
+}
+
+// graph returns the patched module graph for re-serialization.
+func (p *installPlan) graph() (*bunfmt.Graph, error) {
+	g, err := p.exe.Graph()
+	if err != nil {
+		return nil, err
+	}
+	f := &g.Files[p.modIdx]
+	f.Contents = p.match.Apply(p.exe.GetModuleContent(p.mod), payloadData)
+	if p.stripBytecode {
+		f.Bytecode, f.BytecodeOriginPath = nil, nil
+	}
+	if p.sourceMap != nil {
+		f.SourceMap = p.sourceMap
+	}
+	for _, r := range p.replace {
+		if i := g.FileIndex(r.Name); i >= 0 {
+			g.Files[i] = r
+		}
+	}
+	for _, c := range p.carry {
+		if _, err := g.AddFile(c); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range p.remove {
+		if err := g.RemoveFile(g.FileIndex(name)); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// hasBytecode reports whether Bun may run cached bytecode for m instead of
+// its source.
+func hasBytecode(m bunfmt.ModuleStruct) bool {
+	return m.Bytecode.Length > 0 || m.BytecodeOriginPath.Length > 0
+}
+
+// printPlanError reports a planInstall failure, listing validation problems
+// one per line.
+func printPlanError(err error) {
+	var verr *bunfmt.ValidationError
+	if errors.As(err, &verr) {
+		printValidationErrors(err)
+		fmt.Fprintln(os.Stderr, "[!] Refusing to patch an executable that failed validation.")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+}
+
+// dryRunContext is how many bytes of unchanged content the dry-run diff shows
+// on each side of the patch.
+const dryRunContext = 32
+
+func (p *installPlan) printDryRun() error {
+	exe, mod, m := p.exe, p.mod, p.match
+	content := exe.GetModuleContent(mod)
+
+	fmt.Printf("[*] Dry run — nothing will be written\n")
+	if fileExists(journalPath(p.exePath)) {
+		fmt.Printf("[!] An interrupted run left %s; a real install would roll it back first.\n", journalPath(p.exePath))
+	}
+	fmt.Printf("    binary:   %s\n", p.exePath)
+	if p.fromBackup {
+		fmt.Printf("    source:   %s (existing backup)\n", p.srcPath)
+	}
+	fmt.Printf("    module:   [%d] %s (%d bytes)\n", p.modIdx, exe.GetModuleName(mod), len(content))
+	fmt.Printf("    anchor:   %s (%s)\n", m.Anchor.Name, m.Anchor.Kind)
+	fmt.Printf("    offset:   %d in module, %d bytes replaceable\n", m.Offset, m.Space)
+
+	newSize := exe.Src.Size()
+	if p.inPlace() {
+		at := exe.BlobStart + int64(mod.Contents.Offset) + int64(m.Offset)
+		fmt.Printf("    method:   in place at file offset %#x; no offsets change\n", at)
+	} else {
+		graph, err := p.graph()
+		if err != nil {
+			return err
+		}
+		var cw countingWriter
+		if err := exe.WriteExecutable(&cw, graph); err != nil {
+			return fmt.Errorf("re-serializing graph: %w", err)
+		}
+		newSize = cw.n
+		if grow := len(p.patch) - m.Space; grow > 0 {
+			fmt.Printf("    method:   re-serialize module graph (module grows by %d bytes)\n", grow)
+		} else {
+			fmt.Printf("    method:   re-serialize module graph\n")
+		}
+	}
+	if p.stripBytecode {
+		fmt.Printf("    bytecode: %d bytes stripped so the patched source runs\n", mod.Bytecode.Length)
+	}
+	switch {
+	case p.sourceMapErr != nil:
+		fmt.Printf("    srcmap:   left as is, could not be updated: %v\n", p.sourceMapErr)
+	case p.sourceMap != nil:
+		fmt.Printf("    srcmap:   updated for the patch (%d -> %d bytes)\n", mod.SourceMap.Length, len(p.sourceMap))
+	}
+	for _, c := range p.carry {
+		fmt.Printf("    redo:     embed %s\n", c.Name)
+	}
+	for _, r := range p.replace {
+		fmt.Printf("    redo:     replace %s\n", r.Name)
+	}
+	for _, name := range p.remove {
+		fmt.Printf("    redo:     rm %s\n", name)
+	}
+	for _, e := range p.lostEdits {
+		fmt.Printf("    lost:     %s\n", e)
+	}
+	fmt.Printf("    size:     %d -> %d bytes\n", exe.Src.Size(), newSize)
+
+	start := max(m.Offset-dryRunContext, 0)
+	end := min(m.Offset+m.Space+dryRunContext, len(content))
+	before := content[start:end]
+	after := make([]byte, 0, len(before)-m.Space+len(p.patch))
+	after = append(after, content[start:m.Offset]...)
+	after = append(after, p.patch...)
+	after = append(after, content[m.Offset+m.Space:end]...)
+
+	fmt.Printf("\n--- before [%d, %d)\n", start, end)
+	printHexDump("-", start, before)
+	fmt.Printf("+++ after\n")
+	printHexDump("+", start, after)
+	fmt.Println()
+	printTextDiff(before, after)
+
+	fmt.Printf("\n[*] Files:\n")
+	printFileAction("replace", p.exePath, "")
+	switch {
+	case p.fromBackup:
+		printFileAction("keep", p.backupPath, "backup of the unpatched binary")
+	case fileExists(p.backupPath):
+		printFileAction("overwrite", p.backupPath, "stale backup replaced by the current binary")
+	default:
+		printFileAction("create", p.backupPath, "backup")
+	}
+	printFileAction(createOrReplace(p.payloadPath), p.payloadPath, "")
+	if fileExists(p.pluginDir) {
+		printFileAction("keep", p.pluginDir+string(filepath.Separator), "")
+	} else {
+		printFileAction("create", p.pluginDir+string(filepath.Separator), "")
+	}
+	printFileAction(createOrReplace(manifestPath(p.exePath)), manifestPath(p.exePath), "")
+	return nil
+}
+
+func printFileAction(action, path, note string) {
+	if note != "" {
+		note = " (" + note + ")"
+	}
+	fmt.Printf("    %-9s %s%s\n", action, path, note)
+}
+
+func createOrReplace(path string) string {
+	if fileExists(path) {
+		return "replace"
+	}
+	return "create"
+}
+
+// printHexDump prints data in hexdump -C style, each line prefixed with
+// marker and addressed from base.
+func printHexDump(marker string, base int, data []byte) {
+	for off := 0; off < len(data); off += 16 {
+		line := data[off:min(off+16, len(data))]
+		var hex strings.Builder
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				hex.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(&hex, "%02x ", line[i])
+			} else {
+				hex.WriteString("   ")
+			}
+		}
+		fmt.Printf("%s %08x  %s |%s|\n", marker, base+off, hex.String(), printable(line, false))
+	}
+}
+
+// printTextDiff prints the window line by line, marking the lines the patch
+// changes.
+func printTextDiff(before, after []byte) {
+	a := strings.Split(string(printable(before, true)), "\n")
+	b := strings.Split(string(printable(after, true)), "\n")
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	for _, l := range a[:pre] {
+		fmt.Printf("  %s\n", l)
+	}
+	for _, l := range a[pre : len(a)-suf] {
+		fmt.Printf("- %s\n", l)
+	}
+	for _, l := range b[pre : len(b)-suf] {
+		fmt.Printf("+ %s\n", l)
+	}
+	for _, l := range a[len(a)-suf:] {
+		fmt.Printf("  %s\n", l)
+	}
+}
+
+// printable replaces bytes that would garble a terminal with '.'.
+func printable(b []byte, keepNewlines bool) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		switch {
+		case c == '\n' && keepNewlines:
+			out[i] = c
+		case c < 0x20 || c >= 0x7f:
+			out[i] = '.'
+		default:
+			out[i] = c
+		}
+	}
+	return out
+}
+
+// countingWriter discards what is written and counts it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
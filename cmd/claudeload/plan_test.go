@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testOptions returns install options that use only the built-in anchors,
+// whatever the user running the tests has configured.
+func testOptions(t *testing.T) installOptions {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "anchors.json")
+	if err := os.WriteFile(path, []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return installOptions{anchorsPath: path}
+}
+
+// captureStdout returns what f prints to standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+// dirSnapshot returns the names and contents of the files in dir.
+func dirSnapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string)
+	for _, e := range entries {
+		data, _ := os.ReadFile(filepath.Join(dir, e.Name()))
+		out[e.Name()] = string(data)
+	}
+	return out
+}
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	exePath := writeExe(t, dir, testGraph())
+	before := dirSnapshot(t, dir)
+
+	plan, err := planInstall(exePath, testOptions(t))
+	if err != nil {
+		t.Fatalf("planInstall: %v", err)
+	}
+	defer plan.close()
+	var printErr error
+	out := captureStdout(t, func() { printErr = plan.printDryRun() })
+	if printErr != nil {
+		t.Fatalf("printDryRun: %v", printErr)
+	}
+
+	for _, want := range []string{
+		"Dry run",
+		"module:   [1] /$bunfs/root/cli.js",
+		"(after-import)",
+		"re-serialize module graph (module grows by",
+		"+ ",
+		"create    " + exePath + ".original (backup)",
+		"create    " + filepath.Join(dir, "payload.js"),
+		"create    " + manifestPath(exePath),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry-run output lacks %q:\n%s", want, out)
+		}
+	}
+	// The after side of the diff shows the payload where the anchor was.
+	if !strings.Contains(out, string(payloadData[:16])) {
+		t.Errorf("dry-run diff does not show the payload:\n%s", out)
+	}
+	after := dirSnapshot(t, dir)
+	if len(after) != len(before) || after["claude"] != before["claude"] {
+		t.Errorf("dry run changed %s: files %v, want only claude", dir, keys(after))
+	}
+}
+
+// A reinstall patches the backup and says so.
+func TestDryRunReinstall(t *testing.T) {
+	dir := t.TempDir()
+	exePath := writeExe(t, dir, testGraph())
+	backup, err := os.ReadFile(exePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(exePath+".original", backup, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := planInstall(exePath, testOptions(t))
+	if err != nil {
+		t.Fatalf("planInstall: %v", err)
+	}
+	defer plan.close()
+	out := captureStdout(t, func() { plan.printDryRun() })
+	for _, want := range []string{
+		"source:   " + exePath + ".original (existing backup)",
+		"keep      " + exePath + ".original (backup of the unpatched binary)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry-run output lacks %q:\n%s", want, out)
+		}
+	}
+	if got, _ := os.ReadFile(exePath + ".original"); !bytes.Equal(got, backup) {
+		t.Error("dry run changed the backup")
+	}
+}
+
+func TestBytecodeStrip(t *testing.T) {
+	g := testGraph()
+	cli := &g.Files[1]
+	cli.Bytecode = bytes.Repeat([]byte{0xbc}, 64)
+	cli.BytecodeOriginPath = []byte(cli.Name)
+	exePath := writeExe(t, t.TempDir(), g)
+
+	opts := testOptions(t)
+	opts.keepBytecode = true
+	if _, err := planInstall(exePath, opts); !errors.Is(err, errBytecode) {
+		t.Fatalf("planInstall with --bytecode refuse = %v, want errBytecode", err)
+	}
+
+	plan, err := planInstall(exePath, testOptions(t))
+	if err != nil {
+		t.Fatalf("planInstall: %v", err)
+	}
+	defer plan.close()
+	if !plan.stripBytecode || plan.inPlace() {
+		t.Fatalf("stripBytecode = %t, inPlace = %t; want a re-serialized strip", plan.stripBytecode, plan.inPlace())
+	}
+	out := captureStdout(t, func() { plan.printDryRun() })
+	if !strings.Contains(out, "bytecode: 64 bytes stripped") {
+		t.Errorf("dry-run output does not report the strip:\n%s", out)
+	}
+
+	patched, err := plan.graph()
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	f := patched.Files[1]
+	if f.Bytecode != nil || f.BytecodeOriginPath != nil {
+		t.Errorf("patched module kept %d bytes of bytecode and origin %q", len(f.Bytecode), f.BytecodeOriginPath)
+	}
+	if !bytes.Contains(f.Contents, payloadData) {
+		t.Error("patched module lacks the payload")
+	}
+	if other := patched.Files[0]; !bytes.Equal(other.Contents, g.Files[0].Contents) {
+		t.Error("other modules changed")
+	}
+}
+
+func keys(m map[string]string) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
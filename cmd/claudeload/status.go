@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"claudeload/internal/bunfmt"
+)
+
+// patchState is the outcome of status. Each state has its own exit code so
+// that scripts can act on it.
+type patchState int
+
+const (
+	statePatched   patchState = iota // payload present, backup and payload.js in place
+	stateUnpatched                   // never installed, or cleanly uninstalled
+	stateStale                       // a backup exists but the binary was replaced, e.g. by an auto-update
+	stateBroken                      // payload present but the backup or payload.js is missing
+)
+
+func (s patchState) String() string {
+	switch s {
+	case statePatched:
+		return "patched"
+	case stateUnpatched:
+		return "unpatched"
+	case stateStale:
+		return "stale"
+	case stateBroken:
+		return "broken"
+	}
+	return fmt.Sprintf("patchState(%d)", int(s))
+}
+
+// exitCode leaves 1 for ordinary failures such as an unreadable binary.
+func (s patchState) exitCode() int {
+	switch s {
+	case statePatched:
+		return 0
+	case stateUnpatched:
+		return 2
+	case stateStale:
+		return 3
+	}
+	return 4
+}
+
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload status [<path>]\n\n")
+		fmt.Fprintf(os.Stderr, "Exit status: 0 patched, 2 unpatched, 3 stale (binary replaced since install),\n")
+		fmt.Fprintf(os.Stderr, "4 broken (backup or payload.js missing), 1 on error.\n")
+	}
+	fs.Parse(args)
+	exePath := resolveClaudePath(fs.Args())
+
+	dir := filepath.Dir(exePath)
+	backupPath := exePath + ".original"
+	payloadPath := filepath.Join(dir, "payload.js")
+	pluginDir := filepath.Join(dir, "claudeload-plugins")
+
+	// Like ensure, look at whichever install the directory's manifest
+	// describes: after an update it names the previous release's binary.
+	manifest, err := loadManifest(exePath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+	}
+	moduleRef := ""
+	if manifest != nil {
+		backupPath = manifest.Backup
+		moduleRef = manifest.Module.Name
+	}
+
+	probe, err := probePatch(exePath, moduleRef)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	facts := statusFacts{
+		patched:    probe.patched,
+		hasBackup:  fileExists(backupPath),
+		hasPayload: fileExists(payloadPath),
+		manifest:   manifest,
+	}
+	if facts.hasBackup || manifest != nil {
+		if facts.sum, err = fileSHA256(exePath); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+		if facts.hasBackup {
+			facts.backupSum, _ = fileSHA256(backupPath)
+		}
+	}
+	state := facts.classify()
+	changed := manifest != nil && facts.sum != manifest.PatchedSHA256
+
+	fmt.Printf("[*] %s: %s\n", exePath, state)
+	if !probe.version.IsZero() {
+		fmt.Printf("    claude version:      %s\n", probe.version)
+	}
+	if probe.module != "" {
+		fmt.Printf("    module:              %s\n", probe.module)
+	}
+	fmt.Printf("    payload present:     %s\n", yesNo(facts.patched))
+	fmt.Printf("    backup:              %s\n", presence(backupPath, facts.hasBackup))
+	fmt.Printf("    payload.js:          %s\n", presence(payloadPath, facts.hasPayload))
+	if manifest != nil {
+		fmt.Printf("    manifest:            %s (claudeload %s, installed %s)\n",
+			manifestPath(exePath), manifest.Version, manifest.InstalledAt.Format("2006-01-02 15:04:05 MST"))
+		if manifest.Executable != exePath {
+			fmt.Printf("    manifest describes:  %s\n", manifest.Executable)
+		}
+		if changed {
+			fmt.Printf("    binary has changed since it was patched\n")
+		}
+		for _, edit := range []struct {
+			label string
+			names []string
+		}{
+			{"embedded modules:", manifest.Embedded},
+			{"replaced modules:", manifest.Replaced},
+			{"removed modules:", manifest.Removed},
+		} {
+			if len(edit.names) == 0 {
+				continue
+			}
+			fmt.Printf("    %-20s %d\n", edit.label, len(edit.names))
+			for _, name := range edit.names {
+				fmt.Printf("      %s\n", name)
+			}
+		}
+	}
+
+	plugins, err := listPlugins(pluginDir)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Printf("    plugins:             %s does not exist\n", pluginDir)
+	case err != nil:
+		fmt.Printf("    plugins:             %v\n", err)
+	case len(plugins) == 0:
+		fmt.Printf("    plugins:             none in %s\n", pluginDir)
+	default:
+		fmt.Printf("    plugins:             %d in %s\n", len(plugins), pluginDir)
+		for _, name := range plugins {
+			fmt.Printf("      %s\n", name)
+		}
+	}
+
+	if facts.patched && probe.bytecode {
+		fmt.Println("[!] The patched module has precompiled bytecode; Bun may run it and skip the payload. Reinstall with --bytecode strip.")
+	}
+	switch state {
+	case stateStale:
+		fmt.Println("[!] Claude Code appears to have been updated over the patch; the backup belongs to the old version.")
+		if old, err := probePatch(backupPath, moduleRef); err == nil && !old.version.IsZero() && !probe.version.IsZero() {
+			fmt.Printf("    backup version %s, current version %s\n", old.version, probe.version)
+		}
+		fmt.Println("    Run 'claudeload ensure' to patch the current binary.")
+	case stateBroken:
+		fmt.Println("[!] The binary is patched but its backup or payload.js is missing; uninstall will not be able to restore it.")
+	}
+	os.Exit(state.exitCode())
+}
+
+// statusFacts is what status learns about an install before classifying it.
+type statusFacts struct {
+	patched    bool // the binary contains the payload
+	hasBackup  bool
+	hasPayload bool
+	manifest   *installManifest // nil if there is none in the binary's directory
+	sum        string           // sha256 of the binary, if there is a backup or manifest
+	backupSum  string           // sha256 of the backup, if there is one
+}
+
+// classify tells a binary that was never patched, or was restored, from one
+// that was replaced since it was patched. The manifest may describe a
+// previous release's binary, which is exactly the stale case.
+func (f statusFacts) classify() patchState {
+	m := f.manifest
+	switch {
+	case f.patched && f.hasBackup && f.hasPayload:
+		return statePatched
+	case f.patched:
+		return stateBroken
+	case m != nil && f.sum == m.PatchedSHA256:
+		// Only embed has written the binary.
+		return stateUnpatched
+	case f.hasBackup && f.sum == f.backupSum:
+		// The original was restored by hand; the backup is still good.
+		return stateUnpatched
+	case m != nil && f.sum == m.OriginalSHA256:
+		return stateUnpatched
+	case f.hasBackup || m != nil:
+		return stateStale
+	}
+	return stateUnpatched
+}
+
+// claudeVersionMarker precedes the Claude Code release in the banner at the
+// top of cli.js, e.g. "// Version: 2.0.14".
+var claudeVersionMarker = []byte("// Version: ")
+
+// patchProbe is what status and ensure learn from a binary.
+type patchProbe struct {
+	module   string         // name of the module checked for the payload
+	patched  bool           // that module contains payloadData
+	bytecode bool           // that module has precompiled bytecode
+	version  bunfmt.Version // zero if the banner is missing
+}
+
+// probePatch looks for the payload in the module selected by moduleRef (see
+// selectModule) and for the version banner in the entry point.
+func probePatch(exePath, moduleRef string) (*patchProbe, error) {
+	exe, err := bunfmt.LoadExecutable(exePath, verbose)
+	if err != nil {
+		return nil, err
+	}
+	defer exe.Close()
+
+	probe := &patchProbe{}
+	if mod, _, err := selectModule(exe, moduleRef); err == nil {
+		probe.module = exe.GetModuleName(mod)
+		probe.patched = bytes.Contains(exe.GetModuleContent(mod), payloadData)
+		probe.bytecode = hasBytecode(mod)
+	} else if moduleRef == "" {
+		return nil, err
+	}
+	// A module patched by name may have been dropped by an update; that
+	// simply means the binary is no longer patched.
+
+	entry, _, err := selectModule(exe, "")
+	if err != nil {
+		return nil, err
+	}
+	content := exe.GetModuleContent(entry)
+	if i := bytes.Index(content, claudeVersionMarker); i >= 0 {
+		probe.version, _ = bunfmt.ParseVersion(content[i+len(claudeVersionMarker):])
+	}
+	return probe, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func presence(path string, ok bool) string {
+	if ok {
+		return path
+	}
+	return path + " (missing)"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatusClassify(t *testing.T) {
+	install := &installManifest{Executable: "/bin/claude", PatchedSHA256: "patched", OriginalSHA256: "original"}
+	tests := []struct {
+		name  string
+		facts statusFacts
+		want  patchState
+	}{
+		{"never installed", statusFacts{sum: "original"}, stateUnpatched},
+		{"installed", statusFacts{patched: true, hasBackup: true, hasPayload: true, manifest: install, sum: "patched", backupSum: "original"}, statePatched},
+		{"installed before manifests", statusFacts{patched: true, hasBackup: true, hasPayload: true}, statePatched},
+		{"backup missing", statusFacts{patched: true, hasPayload: true, manifest: install, sum: "patched"}, stateBroken},
+		{"payload.js missing", statusFacts{patched: true, hasBackup: true, manifest: install, sum: "patched", backupSum: "original"}, stateBroken},
+		{"updated over the patch", statusFacts{hasBackup: true, hasPayload: true, manifest: install, sum: "updated", backupSum: "original"}, stateStale},
+		{"updated, no manifest", statusFacts{hasBackup: true, sum: "updated", backupSum: "original"}, stateStale},
+		{"updated, backup gone", statusFacts{manifest: install, sum: "updated"}, stateStale},
+		{"restored by hand", statusFacts{hasBackup: true, hasPayload: true, manifest: install, sum: "original", backupSum: "original"}, stateUnpatched},
+		{"restored by hand, no manifest", statusFacts{hasBackup: true, sum: "original", backupSum: "original"}, stateUnpatched},
+		{"restored, backup gone", statusFacts{manifest: install, sum: "original"}, stateUnpatched},
+		{"embed only", statusFacts{hasBackup: true, manifest: install, sum: "patched", backupSum: "original"}, stateUnpatched},
+		{"embed only, then updated", statusFacts{hasBackup: true, manifest: install, sum: "updated", backupSum: "original"}, stateStale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.facts.classify(); got != tt.want {
+				t.Errorf("classify = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// After a native-installer update the binary is a new file next to the old
+// one; status must still find the old install's manifest.
+func TestStatusFindsManifestAfterUpdate(t *testing.T) {
+	dir := t.TempDir()
+	oldExe, want := writeInstall(t, dir)
+	newExe := filepath.Join(dir, "claude-2")
+	if err := os.WriteFile(newExe, []byte("updated"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readManifest(newExe); !os.IsNotExist(err) {
+		t.Errorf("readManifest(new binary) = %v, want not found", err)
+	}
+	m, err := loadManifest(newExe)
+	if err != nil {
+		t.Fatalf("loadManifest: %v", err)
+	}
+	if m.Executable != oldExe || m.Backup != want.Backup {
+		t.Fatalf("loadManifest = %+v, want the install of %s", m, oldExe)
+	}
+	sum, _ := fileSHA256(newExe)
+	backupSum, _ := fileSHA256(m.Backup)
+	facts := statusFacts{hasBackup: true, hasPayload: true, manifest: m, sum: sum, backupSum: backupSum}
+	if got := facts.classify(); got != stateStale {
+		t.Errorf("classify = %s, want %s", got, stateStale)
+	}
+}
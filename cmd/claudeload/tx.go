@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"claudeload/internal/txn"
+)
+
+// journalPath is where install and uninstall journal their changes to
+// exePath until they commit.
+func journalPath(exePath string) string {
+	return exePath + ".claudeload-journal"
+}
+
+// beginTx rolls back any transaction a previous run left behind for exePath,
+// starts a new one, and arranges for Ctrl-C or SIGTERM to roll it back. The
+// caller must call the returned stop function before committing, so that a
+// late signal cannot undo a committed install.
+func beginTx(exePath string) (*txn.Tx, func()) {
+	journal := journalPath(exePath)
+	found, err := txn.Recover(journal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] failed to roll back interrupted run: %v\n", err)
+		fmt.Fprintf(os.Stderr, "    journal kept at %s\n", journal)
+		os.Exit(1)
+	}
+	if found {
+		fmt.Printf("[*] Rolled back an interrupted claudeload run on %s\n", exePath)
+	}
+
+	tx, err := txn.Begin(journal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", permHint(err))
+		os.Exit(1)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if s, ok := <-sig; ok {
+			abortTx(tx, "interrupted by %v", s)
+		}
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			signal.Stop(sig)
+			close(sig)
+		})
+	}
+	return tx, stop
+}
+
+// abortTx reports a failure, rolls back every change tx has made and exits.
+func abortTx(tx *txn.Tx, format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "[!] "+format+"\n", args...)
+	if err := tx.Rollback(); errors.Is(err, txn.ErrAborted) {
+		fmt.Fprintln(os.Stderr, "[!] changes were already committed; nothing rolled back.")
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] rollback incomplete: %v\n", err)
+		fmt.Fprintf(os.Stderr, "    journal kept at %s; the next install or uninstall will retry\n", tx.JournalPath())
+	} else {
+		fmt.Fprintln(os.Stderr, "[*] All changes rolled back.")
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// runWatch re-runs ensure each time the claude binary is replaced. Each run
+// is a separate claudeload process, so a failed re-patch is rolled back and
+// reported without stopping the daemon.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	settle := fs.Duration("settle", 2*time.Second, "wait until the binary has been quiet this long before re-patching")
+	interval := fs.Duration("interval", 5*time.Second, "polling interval on platforms without inotify")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: claudeload watch [--settle d] [--interval d] [<path>]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// Keep the unresolved path: updaters often re-point a symlink, and ensure
+	// must follow it to the new release.
+	target := watchTarget(fs.Args())
+	paths := []string{target}
+	if resolved := normalizePath(target); resolved != target {
+		paths = append(paths, resolved)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+		os.Exit(1)
+	}
+	ensureArgs := []string{"ensure", target}
+	if verbose {
+		ensureArgs = append([]string{"-v"}, ensureArgs...)
+	}
+
+	changed := make(chan struct{}, 1)
+	ensure := func() {
+		cmd := exec.Command(self, ensureArgs...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] ensure failed: %v\n", err)
+		}
+		// Drop the events caused by ensure's own writes.
+		select {
+		case <-changed:
+		default:
+		}
+	}
+
+	ensure()
+	go func() {
+		if err := watchFiles(paths, *interval, changed); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] %v\n", err)
+			os.Exit(1)
+		}
+	}()
+	for _, p := range paths {
+		fmt.Printf("[*] Watching %s\n", p)
+	}
+
+	for range changed {
+		timer := time.NewTimer(*settle)
+		for waiting := true; waiting; {
+			select {
+			case <-changed:
+				timer.Reset(*settle)
+			case <-timer.C:
+				waiting = false
+			}
+		}
+		fmt.Printf("[*] %s changed at %s\n", target, time.Now().Format(time.TimeOnly))
+		ensure()
+	}
+}
+
+// watchTarget is like resolveClaudePath but does not resolve symlinks.
+func watchTarget(args []string) string {
+	p := ""
+	if len(args) >= 1 {
+		p = args[0]
+	} else {
+		var err error
+		if p, err = findClaudeInPath("claude"); err != nil {
+			fmt.Fprintf(os.Stderr, "[!] 'claude' not found in PATH: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return p
+}
+
+// notify signals c without blocking; one pending signal is enough.
+func notify(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// watchFiles signals changed whenever one of paths is written, created or
+// renamed into place. It watches the parent directories with inotify, since
+// updates usually replace the file rather than modify it.
+func watchFiles(paths []string, _ time.Duration, changed chan<- struct{}) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	names := make(map[int32]map[string]bool)
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		wd, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_CREATE|syscall.IN_MOVED_TO)
+		if err != nil {
+			return fmt.Errorf("watching %s: %w", dir, err)
+		}
+		if names[int32(wd)] == nil {
+			names[int32(wd)] = make(map[string]bool)
+		}
+		names[int32(wd)][filepath.Base(p)] = true
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("inotify: %w", err)
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + int(ev.Len)
+			name := string(bytes.TrimRight(buf[start:off], "\x00"))
+			if names[ev.Wd][name] {
+				notify(changed)
+			}
+		}
+	}
+}
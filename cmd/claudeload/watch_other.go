@@ -0,0 +1,42 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// fileStamp is enough of a file's metadata to notice it being replaced.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+	link    string
+}
+
+func stampOf(path string) fileStamp {
+	var s fileStamp
+	s.link, _ = os.Readlink(path)
+	if fi, err := os.Stat(path); err == nil {
+		s.size, s.modTime = fi.Size(), fi.ModTime()
+	}
+	return s
+}
+
+// watchFiles signals changed whenever one of paths changes, polling every
+// interval.
+func watchFiles(paths []string, interval time.Duration, changed chan<- struct{}) error {
+	last := make([]fileStamp, len(paths))
+	for i, p := range paths {
+		last[i] = stampOf(p)
+	}
+	for range time.Tick(interval) {
+		for i, p := range paths {
+			if s := stampOf(p); s != last[i] {
+				last[i] = s
+				notify(changed)
+			}
+		}
+	}
+	return nil
+}
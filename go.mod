@@ -1,3 +1,5 @@
 module claudeload
 
 go 1.22
+
+require github.com/klauspost/compress v1.18.0
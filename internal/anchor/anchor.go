@@ -0,0 +1,272 @@
+// Package anchor locates the place in a module's source where a payload is
+// injected. An anchor is a literal byte string, a regular expression, or the
+// end of the first import/require statement; each match reports how many
+// bytes at that position may be overwritten.
+//
+// The kind of an anchor does not decide precedence; Priority does. Find
+// tries anchors from the highest priority down and uses the first priority
+// level at which any anchor matches, so a low-priority fallback such as
+// after-import is only consulted when nothing above it matched. A patch site
+// must be unambiguous:
+//
+//   - a literal or regex anchor that matches the content more than once,
+//     overlapping occurrences of a literal included, is an error;
+//   - two anchors of the same priority that both match are an error, even if
+//     they match at the same place;
+//   - after-import is unique by definition: it is the end of whichever
+//     import or require statement starts first.
+//
+// Regex matches are found leftmost-first without overlap, as by
+// regexp.FindAllIndex, so a pattern such as "a+" matches "aaa" once.
+package anchor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Errors returned by Locate and Find. Match them with errors.Is.
+var (
+	ErrNoMatch   = errors.New("no patch anchor matched")
+	ErrAmbiguous = errors.New("patch anchor is ambiguous")
+)
+
+// Kind selects how an anchor's Pattern is interpreted.
+type Kind string
+
+const (
+	KindLiteral     Kind = "literal"      // Pattern is matched byte for byte and may be overwritten
+	KindRegex       Kind = "regex"        // the whole regexp match may be overwritten
+	KindAfterImport Kind = "after-import" // insert after the first import/require statement; Pattern is unused
+)
+
+// Anchor is one candidate patch location. Anchors are tried in descending
+// Priority; see the package documentation for how matches are chosen.
+type Anchor struct {
+	Name     string `json:"name"`
+	Kind     Kind   `json:"kind"`
+	Pattern  string `json:"pattern,omitempty"`
+	Priority int    `json:"priority"`
+	Disabled bool   `json:"disabled,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Match is where an anchor matched. The payload goes at Offset and may
+// overwrite up to Space bytes; Space is 0 for insertion-only anchors.
+type Match struct {
+	Anchor *Anchor
+	Offset int
+	Space  int
+}
+
+// importStatement matches a static import, including side-effect imports, in
+// both formatted and minified code. It must start a line or follow the end of
+// a statement, so that import-like text inside a string does not match.
+var importStatement = regexp.MustCompile(`(?m)(?:^|[;}])[ \t]*import\s*(?:[\w$*{}\s,]+?\s*from\s*)?["'][^"'\n]+["']\s*;?`)
+
+// requireStatement matches a CommonJS require bound to a variable, starting a
+// line or statement like importStatement. The trailing semicolon is required
+// so that inserting after it cannot split an expression.
+var requireStatement = regexp.MustCompile(`(?m)(?:^|[;}])[ \t]*(?:const|let|var)\s+[\w$]+\s*=\s*require\(\s*["'][^"'\n]+["']\s*\)\s*;`)
+
+func (a *Anchor) compile() error {
+	switch a.Kind {
+	case KindLiteral:
+		if a.Pattern == "" {
+			return fmt.Errorf("anchor %q: empty pattern", a.Name)
+		}
+	case KindRegex:
+		re, err := regexp.Compile(a.Pattern)
+		if err != nil {
+			return fmt.Errorf("anchor %q: %w", a.Name, err)
+		}
+		a.re = re
+	case KindAfterImport:
+	default:
+		return fmt.Errorf("anchor %q: unknown kind %q", a.Name, a.Kind)
+	}
+	return nil
+}
+
+// Locate finds the anchor in content. It returns an error wrapping
+// ErrNoMatch when the anchor does not occur and ErrAmbiguous when it occurs
+// more than once.
+func (a *Anchor) Locate(content []byte) (Match, error) {
+	switch a.Kind {
+	case KindLiteral:
+		pattern := []byte(a.Pattern)
+		i := bytes.Index(content, pattern)
+		if i < 0 {
+			break
+		}
+		if j := bytes.Index(content[i+1:], pattern); j >= 0 {
+			return Match{}, fmt.Errorf("anchor %q: %w: matches at offsets %d and %d", a.Name, ErrAmbiguous, i, i+1+j)
+		}
+		return Match{Anchor: a, Offset: i, Space: len(pattern)}, nil
+	case KindRegex:
+		if a.re == nil {
+			if err := a.compile(); err != nil {
+				return Match{}, err
+			}
+		}
+		locs := a.re.FindAllIndex(content, 2)
+		if len(locs) > 1 {
+			return Match{}, fmt.Errorf("anchor %q: %w: matches at offsets %d and %d", a.Name, ErrAmbiguous, locs[0][0], locs[1][0])
+		}
+		if len(locs) == 1 {
+			return Match{Anchor: a, Offset: locs[0][0], Space: locs[0][1] - locs[0][0]}, nil
+		}
+	case KindAfterImport:
+		end := -1
+		for _, re := range []*regexp.Regexp{importStatement, requireStatement} {
+			if loc := re.FindIndex(content); loc != nil && (end < 0 || loc[0] < end) {
+				end = loc[1]
+			}
+		}
+		if end >= 0 {
+			return Match{Anchor: a, Offset: end}, nil
+		}
+	default:
+		return Match{}, fmt.Errorf("anchor %q: unknown kind %q", a.Name, a.Kind)
+	}
+	return Match{}, fmt.Errorf("anchor %q: %w", a.Name, ErrNoMatch)
+}
+
+// Patch returns the bytes that replace content[m.Offset:m.Offset+m.Space].
+// A payload that fits is padded with spaces to exactly Space bytes, so the
+// module keeps its length; otherwise the result is longer than Space and
+// ends with ";\n", so that whatever follows the anchor starts a new
+// statement.
+func (m Match) Patch(payload []byte) []byte {
+	if len(payload) <= m.Space {
+		out := make([]byte, m.Space)
+		copy(out, payload)
+		for i := len(payload); i < len(out); i++ {
+			out[i] = ' '
+		}
+		return out
+	}
+	if m.Space == 0 {
+		// Inserted between two statements: keep it on its own line and
+		// terminated.
+		out := make([]byte, 0, len(payload)+2)
+		out = append(out, '\n')
+		out = append(out, payload...)
+		return append(out, ';')
+	}
+	out := make([]byte, 0, len(payload)+2)
+	out = append(out, payload...)
+	return append(out, ';', '\n')
+}
+
+// Apply returns content with the payload applied at m.
+func (m Match) Apply(content, payload []byte) []byte {
+	patch := m.Patch(payload)
+	out := make([]byte, 0, len(content)-m.Space+len(patch))
+	out = append(out, content[:m.Offset]...)
+	out = append(out, patch...)
+	return append(out, content[m.Offset+m.Space:]...)
+}
+
+// Find tries the enabled anchors in descending priority and returns the
+// match of the highest priority at which one matches. An anchor that
+// matches more than once, or two anchors of that priority that both match,
+// is an error wrapping ErrAmbiguous; no match at all is ErrNoMatch.
+func Find(anchors []Anchor, content []byte) (Match, error) {
+	order := sorted(append([]Anchor(nil), anchors...))
+	var found *Match
+	for i := range order {
+		a := &order[i]
+		if a.Disabled {
+			continue
+		}
+		if found != nil && a.Priority < found.Anchor.Priority {
+			break
+		}
+		m, err := a.Locate(content)
+		if errors.Is(err, ErrNoMatch) {
+			continue
+		}
+		if err != nil {
+			return Match{}, err
+		}
+		if found != nil {
+			return Match{}, fmt.Errorf("%w: anchors %q and %q both match at priority %d", ErrAmbiguous, found.Anchor.Name, a.Name, a.Priority)
+		}
+		found = &m
+	}
+	if found == nil {
+		return Match{}, ErrNoMatch
+	}
+	return *found, nil
+}
+
+// sorted orders anchors by descending priority in place, keeping the given
+// order among equal priorities, and returns the slice.
+func sorted(anchors []Anchor) []Anchor {
+	sort.SliceStable(anchors, func(i, j int) bool {
+		return anchors[i].Priority > anchors[j].Priority
+	})
+	return anchors
+}
+
+// Merge overlays overrides on defaults: an override replaces the whole default
+// of the same name, and any other override is added. The result is sorted.
+func Merge(defaults, overrides []Anchor) []Anchor {
+	out := append([]Anchor(nil), defaults...)
+	for _, o := range overrides {
+		replaced := false
+		for i := range out {
+			if out[i].Name == o.Name {
+				out[i] = o
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, o)
+		}
+	}
+	return sorted(out)
+}
+
+// Load reads a JSON array of anchors from path and checks that each one
+// compiles. A missing file is reported as an error satisfying os.IsNotExist.
+func Load(path string) ([]Anchor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var anchors []Anchor
+	if err := json.Unmarshal(data, &anchors); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	for i := range anchors {
+		if anchors[i].Name == "" {
+			return nil, fmt.Errorf("reading %s: anchor %d has no name", path, i)
+		}
+		if anchors[i].Disabled && anchors[i].Kind == "" {
+			continue
+		}
+		if err := anchors[i].compile(); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	return anchors, nil
+}
+
+// DefaultConfigPath is the conventional location of the user anchor file.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "claudeload", "anchors.json"), nil
+}
@@ -0,0 +1,142 @@
+package anchor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		name       string
+		anchor     Anchor
+		content    string
+		wantOffset int
+		wantSpace  int
+		wantErr    error
+	}{
+		{"literal", Anchor{Kind: KindLiteral, Pattern: "// banner"}, "x;\n// banner\ny;", 3, 9, nil},
+		{"literal missing", Anchor{Kind: KindLiteral, Pattern: "// banner"}, "x;", 0, 0, ErrNoMatch},
+		{"literal twice", Anchor{Kind: KindLiteral, Pattern: "// banner"}, "// banner\n// banner\n", 0, 0, ErrAmbiguous},
+		{"literal overlapping", Anchor{Kind: KindLiteral, Pattern: "aa"}, "xaaa", 0, 0, ErrAmbiguous},
+		{"regex", Anchor{Kind: KindRegex, Pattern: `// \(c\) [^\n]*`}, "a;\n// (c) Acme\nb;", 3, 11, nil},
+		{"regex missing", Anchor{Kind: KindRegex, Pattern: `// \(c\)`}, "a;", 0, 0, ErrNoMatch},
+		{"regex twice", Anchor{Kind: KindRegex, Pattern: `\bfoo\b`}, "foo(); foo();", 0, 0, ErrAmbiguous},
+		{"regex leftmost without overlap", Anchor{Kind: KindRegex, Pattern: `a+`}, "xaaa", 1, 3, nil},
+		{"import", Anchor{Kind: KindAfterImport}, "import {a} from './a.js';\nimport b from 'b';\nrun();", 25, 0, nil},
+		{"side-effect import", Anchor{Kind: KindAfterImport}, `import"./x.js";run()`, 15, 0, nil},
+		{"minified import", Anchor{Kind: KindAfterImport}, `import{a as b}from"./a.js";b()`, 27, 0, nil},
+		{"require", Anchor{Kind: KindAfterImport}, "const fs = require(\"fs\");\nrun();", 25, 0, nil},
+		{"earliest of import and require", Anchor{Kind: KindAfterImport}, "var p = require('p');\nimport x from 'x';", 21, 0, nil},
+		{"require without semicolon", Anchor{Kind: KindAfterImport}, "const fs = require('fs')\nrun()", 0, 0, ErrNoMatch},
+		{"no import", Anchor{Kind: KindAfterImport}, "run();", 0, 0, ErrNoMatch},
+		{"indented import", Anchor{Kind: KindAfterImport}, "  import a from 'a';\nrun();", 20, 0, nil},
+		{"import after a statement", Anchor{Kind: KindAfterImport}, `"use strict";import"./x.js";run()`, 28, 0, nil},
+		{"import after a block", Anchor{Kind: KindAfterImport}, `if(a){}import"./x.js";run()`, 22, 0, nil},
+		{"import in a string", Anchor{Kind: KindAfterImport}, "log(\"import a from 'a';\");\nrun();", 0, 0, ErrNoMatch},
+		{"require in a string", Anchor{Kind: KindAfterImport}, "log(\"const fs = require('fs');\");", 0, 0, ErrNoMatch},
+		{"string before the real import", Anchor{Kind: KindAfterImport}, "s = \"import a from 'a';\";\nimport b from 'b';\nrun();", 44, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.anchor.Name = tt.name
+			m, err := tt.anchor.Locate([]byte(tt.content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Locate error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if m.Offset != tt.wantOffset || m.Space != tt.wantSpace {
+				t.Errorf("Locate = offset %d space %d, want offset %d space %d", m.Offset, m.Space, tt.wantOffset, tt.wantSpace)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	const content = "import a from 'a';\n// (c) Acme. All rights reserved.\nrun();"
+	literal := Anchor{Name: "literal", Kind: KindLiteral, Pattern: "// (c) Acme. All rights reserved.", Priority: 100}
+	regex := Anchor{Name: "regex", Kind: KindRegex, Pattern: `// \(c\) [^\n]*`, Priority: 50}
+	after := Anchor{Name: "after", Kind: KindAfterImport}
+	missing := Anchor{Name: "missing", Kind: KindLiteral, Pattern: "nowhere", Priority: 200}
+
+	disabled := literal
+	disabled.Disabled = true
+	samePriority := regex
+	samePriority.Priority = literal.Priority
+	ambiguousLow := Anchor{Name: "ambiguous-low", Kind: KindRegex, Pattern: `\w+`, Priority: 10}
+
+	tests := []struct {
+		name    string
+		anchors []Anchor
+		want    string
+		wantErr error
+	}{
+		{"highest priority wins", []Anchor{after, regex, literal}, "literal", nil},
+		{"unmatched anchors are skipped", []Anchor{missing, after, regex}, "regex", nil},
+		{"disabled anchors are skipped", []Anchor{disabled, regex}, "regex", nil},
+		{"fallback", []Anchor{missing, after}, "after", nil},
+		{"lower priorities are not consulted", []Anchor{literal, ambiguousLow}, "literal", nil},
+		{"same priority both match", []Anchor{literal, samePriority}, "", ErrAmbiguous},
+		{"ambiguous anchor", []Anchor{ambiguousLow, after}, "", ErrAmbiguous},
+		{"nothing matches", []Anchor{missing}, "", ErrNoMatch},
+		{"no anchors", nil, "", ErrNoMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Find(tt.anchors, []byte(content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Find error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && m.Anchor.Name != tt.want {
+				t.Errorf("Find chose %q, want %q", m.Anchor.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   Match
+		content string
+		payload string
+		want    string
+	}{
+		{"fits", Match{Offset: 2, Space: 6}, "a;banner;b", "p()", "a;p()   ;b"},
+		{"grows", Match{Offset: 2, Space: 2}, "a;xx;b", "p()", "a;p();\n;b"},
+		{"grows over a comment", Match{Offset: 2, Space: 4}, "a;/**/b()", "p()+1", "a;p()+1;\nb()"},
+		{"insert", Match{Offset: 2}, "a;b", "p()", "a;\np();b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.match.Apply([]byte(tt.content), []byte(tt.payload))); got != tt.want {
+				t.Errorf("Apply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defaults := []Anchor{
+		{Name: "a", Kind: KindLiteral, Pattern: "a", Priority: 10},
+		{Name: "b", Kind: KindLiteral, Pattern: "b", Priority: 5},
+	}
+	overrides := []Anchor{
+		{Name: "b", Kind: KindRegex, Pattern: "b+", Priority: 20},
+		{Name: "c", Kind: KindLiteral, Pattern: "c", Priority: 1},
+	}
+	got := Merge(defaults, overrides)
+	want := []string{"b", "a", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("Merge returned %d anchors, want %d", len(got), len(want))
+	}
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Errorf("anchor %d = %q, want %q", i, got[i].Name, name)
+		}
+	}
+	if got[0].Kind != KindRegex {
+		t.Errorf("override of b kept kind %q", got[0].Kind)
+	}
+}
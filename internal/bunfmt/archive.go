@@ -0,0 +1,177 @@
+package bunfmt
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExtractFormats are the output formats ExtractBunExe can write.
+var ExtractFormats = []string{"dir", "tar", "tar.gz", "zip"}
+
+// PAXModuleName is the PAX record that carries the embedded module name of
+// each entry in a tar extraction, as the entry comment does in a zip. The
+// standard comment record is used because tar ignores it silently, where it
+// warns about vendor records.
+const PAXModuleName = "comment"
+
+// ExtractFormatForPath guesses the output format from an output path's
+// extension, defaulting to a directory.
+func ExtractFormatForPath(p string) string {
+	switch lower := strings.ToLower(p); {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	}
+	return "dir"
+}
+
+// extractSink receives the files of an extraction. Paths are slash-separated
+// and relative to the extraction root; module is the embedded module a file
+// belongs to, or "" for the manifest.
+type extractSink interface {
+	WriteFile(name, module string, data []byte) error
+	Close() error
+}
+
+func newExtractSink(format, out string) (extractSink, error) {
+	if format == "dir" {
+		if err := os.MkdirAll(out, 0o755); err != nil {
+			return nil, fmt.Errorf("creating output directory: %w", err)
+		}
+		return dirSink(out), nil
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "tar":
+		return &tarSink{f: f, tw: tar.NewWriter(f)}, nil
+	case "tar.gz":
+		gz := gzip.NewWriter(f)
+		return &tarSink{f: f, gz: gz, tw: tar.NewWriter(gz)}, nil
+	case "zip":
+		return &zipSink{f: f, zw: zip.NewWriter(f)}, nil
+	}
+	f.Close()
+	os.Remove(out)
+	return nil, fmt.Errorf("unknown output format %q (want %s)", format, strings.Join(ExtractFormats, ", "))
+}
+
+// entryName cleans the slash-separated path name and refuses one that would
+// land outside the extraction root, whether it is absolute or climbs out
+// with "..". Module names come from the executable and cannot be trusted.
+// Backslashes and drive letters are treated as Windows would, so that an
+// archive is safe to unpack there too.
+func entryName(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	drive := len(clean) > 1 && clean[1] == ':'
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) || drive {
+		return "", fmt.Errorf("refusing to write %q outside the extraction root", name)
+	}
+	return clean, nil
+}
+
+type dirSink string
+
+func (d dirSink) WriteFile(name, module string, data []byte) error {
+	name, err := entryName(name)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+func (d dirSink) Close() error { return nil }
+
+// archiveTime is the modification time of every archive entry. Entries carry
+// no real timestamps so that extracting a binary twice gives the same archive.
+var archiveTime = time.Unix(0, 0).UTC()
+
+type tarSink struct {
+	f  *os.File
+	gz *gzip.Writer // nil for an uncompressed tar
+	tw *tar.Writer
+}
+
+func (t *tarSink) WriteFile(name, module string, data []byte) error {
+	name, err := entryName(name)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  archiveTime,
+		Format:   tar.FormatPAX,
+	}
+	if module != "" {
+		hdr.PAXRecords = map[string]string{PAXModuleName: module}
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = t.tw.Write(data)
+	return err
+}
+
+func (t *tarSink) Close() error {
+	err := t.tw.Close()
+	if t.gz != nil {
+		if gerr := t.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	if ferr := t.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+type zipSink struct {
+	f  *os.File
+	zw *zip.Writer
+}
+
+func (z *zipSink) WriteFile(name, module string, data []byte) error {
+	name, err := entryName(name)
+	if err != nil {
+		return err
+	}
+	w, err := z.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Comment:  module,
+		Modified: archiveTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (z *zipSink) Close() error {
+	err := z.zw.Close()
+	if ferr := z.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
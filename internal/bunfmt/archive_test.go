@@ -0,0 +1,55 @@
+package bunfmt
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestEntryName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // "" when the name must be refused
+	}{
+		{"root/cli.js.js", "root/cli.js.js"},
+		{"root/./lib//a.js", "root/lib/a.js"},
+		{"root/../a.js", "a.js"},
+		{`root\lib\a.js`, "root/lib/a.js"},
+		{"../x", ""},
+		{"../../x", ""},
+		{"root/../../x", ""},
+		{"..", ""},
+		{".", ""},
+		{"/etc/passwd", ""},
+		{`\\server\share\x`, ""},
+		{`C:\x`, ""},
+		{"C:x", ""},
+	}
+	for _, tt := range tests {
+		got, err := entryName(tt.in)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("entryName(%q) = %q, want an error", tt.in, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("entryName(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveOutputPathStaysInside(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"/$bunfs/root/cli.js", "root/cli.js.js"},
+		{"../../x", "x.js"},
+		{"/$bunfs/root/../../../etc/y", "root/etc/y.js"},
+		{"./a/./b", "a/b.js"},
+		{"..", "module_3.js"},
+	}
+	for _, tt := range tests {
+		got := filepath.ToSlash(resolveOutputPath("", tt.name, 1, 3))
+		if got != tt.want {
+			t.Errorf("resolveOutputPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,11 +3,7 @@ package bunfmt
 // Trailer is the magic byte sequence appended by bun build --compile.
 var Trailer = []byte("\n---- Bun! ----\n")
 
-const (
-	OffsetsStructSize = 32
-	ModuleStructSize  = 52
-	ChunkSize         = 4096
-)
+const ChunkSize = 4096
 
 // LoaderExtension maps the Loader enum (u8) to a file extension.
 // Source: bun.options.Loader
@@ -40,3 +36,39 @@ var EncodingName = map[uint8]string{
 	1: "latin1",
 	2: "utf8",
 }
+
+// LoaderName maps the Loader enum (u8) to Bun's name for it.
+var LoaderName = map[uint8]string{
+	0:  "jsx",
+	1:  "js",
+	2:  "ts",
+	3:  "tsx",
+	4:  "css",
+	5:  "file",
+	6:  "json",
+	7:  "jsonc",
+	8:  "toml",
+	9:  "wasm",
+	10: "napi",
+	11: "base64",
+	12: "dataurl",
+	13: "text",
+	14: "bunsh",
+	15: "sqlite",
+	16: "sqlite_embedded",
+	17: "html",
+	18: "yaml",
+	19: "json5",
+	20: "md",
+}
+
+var ModuleFormatName = map[uint8]string{
+	0: "none",
+	1: "esm",
+	2: "cjs",
+}
+
+var SideName = map[uint8]string{
+	0: "server",
+	1: "client",
+}
@@ -0,0 +1,161 @@
+package bunfmt
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// ModuleRoots are the prefixes of embedded module names: Bun mounts the
+// module graph at /$bunfs/ on POSIX systems and at B:\~BUN\ on Windows.
+var ModuleRoots = []string{"/$bunfs/", `B:\~BUN\`}
+
+// ModuleRoot returns the root prefix of an embedded module name, or "" if
+// name is not under one.
+func ModuleRoot(name string) string {
+	for _, root := range ModuleRoots {
+		if strings.HasPrefix(name, root) {
+			return root
+		}
+	}
+	return ""
+}
+
+// loaderByExtension maps file extensions to the Loader Bun picks for them.
+var loaderByExtension = map[string]uint8{
+	".jsx":    0,
+	".js":     1,
+	".mjs":    1,
+	".cjs":    1,
+	".ts":     2,
+	".mts":    2,
+	".cts":    2,
+	".tsx":    3,
+	".css":    4,
+	".json":   6,
+	".jsonc":  7,
+	".toml":   8,
+	".wasm":   9,
+	".node":   10,
+	".txt":    13,
+	".sh":     14,
+	".sqlite": 15,
+	".html":   17,
+	".yaml":   18,
+	".yml":    18,
+	".json5":  19,
+	".md":     20,
+}
+
+// LoaderForName returns the Loader for a module name by its extension.
+// Unknown extensions get the file loader, which embeds the bytes as an opaque
+// asset.
+func LoaderForName(name string) uint8 {
+	if l, ok := loaderByExtension[strings.ToLower(path.Ext(strings.ReplaceAll(name, `\`, "/")))]; ok {
+		return l
+	}
+	return 5
+}
+
+// LoaderByName returns the Loader with Bun's name for it, e.g. "js".
+func LoaderByName(name string) (uint8, bool) {
+	return enumValue(LoaderName, name)
+}
+
+// IsSourceLoader reports whether Bun parses modules with loader l as
+// JavaScript.
+func IsSourceLoader(l uint8) bool {
+	return l <= 3
+}
+
+// NewGraphFile returns a module named name holding contents, with the loader
+// chosen from the name's extension. Source files are stored as latin1 when
+// they are plain ASCII, as bun build emits them, and as utf8 otherwise;
+// everything else is stored as binary. .mjs and .cjs files get the matching
+// module format; other sources are left for the caller to set.
+func NewGraphFile(name string, contents []byte) GraphFile {
+	f := GraphFile{Name: name, Contents: contents, Loader: LoaderForName(name)}
+	f.Encoding = fileEncoding(f.Loader, contents)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mjs", ".mts":
+		f.ModuleFormat = 1
+	case ".cjs", ".cts":
+		f.ModuleFormat = 2
+	}
+	return f
+}
+
+func fileEncoding(loader uint8, contents []byte) uint8 {
+	if !IsSourceLoader(loader) {
+		return 0
+	}
+	for _, c := range contents {
+		if c >= 0x80 {
+			if utf8.Valid(contents) {
+				return 2
+			}
+			return 0
+		}
+	}
+	return 1
+}
+
+// FileIndex returns the index of the module called name, or -1.
+func (g *Graph) FileIndex(name string) int {
+	for i := range g.Files {
+		if g.Files[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddFile appends f to the graph and returns its index. Module names must be
+// unique and, like every name bun build emits, under one of ModuleRoots.
+func (g *Graph) AddFile(f GraphFile) (int, error) {
+	if ModuleRoot(f.Name) == "" {
+		return 0, fmt.Errorf("module name %q is not under %s", f.Name, strings.Join(ModuleRoots, " or "))
+	}
+	if g.FileIndex(f.Name) >= 0 {
+		return 0, fmt.Errorf("module %q already exists", f.Name)
+	}
+	g.Files = append(g.Files, f)
+	return len(g.Files) - 1, nil
+}
+
+// ReplaceContents gives module i new contents and drops what was derived
+// from the old ones: its bytecode and module info, which Bun would otherwise
+// prefer over the new source, and its source map unless sourceMap replaces
+// it.
+func (g *Graph) ReplaceContents(i int, contents, sourceMap []byte) error {
+	if i < 0 || i >= len(g.Files) {
+		return fmt.Errorf("module index %d out of range [0, %d)", i, len(g.Files))
+	}
+	f := &g.Files[i]
+	f.Contents = contents
+	f.SourceMap = sourceMap
+	f.Bytecode, f.BytecodeOriginPath, f.ModuleInfo = nil, nil, nil
+	// Plain ASCII is valid in either text encoding, so a utf8 module stays
+	// utf8.
+	if enc := fileEncoding(f.Loader, contents); IsSourceLoader(f.Loader) && !(f.Encoding == 2 && enc == 1) {
+		f.Encoding = enc
+	}
+	return nil
+}
+
+// RemoveFile deletes module i, keeping EntryPointID on the same module. The
+// entry point itself cannot be removed.
+func (g *Graph) RemoveFile(i int) error {
+	if i < 0 || i >= len(g.Files) {
+		return fmt.Errorf("module index %d out of range [0, %d)", i, len(g.Files))
+	}
+	if i == int(g.EntryPointID) {
+		return fmt.Errorf("module %q is the entry point", g.Files[i].Name)
+	}
+	g.Files = append(g.Files[:i], g.Files[i+1:]...)
+	if i < int(g.EntryPointID) {
+		g.EntryPointID--
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package bunfmt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewGraphFile(t *testing.T) {
+	tests := []struct {
+		name, contents string
+		wantLoader     uint8
+		wantEncoding   uint8
+		wantFormat     uint8
+	}{
+		{"/$bunfs/root/a.js", "x()", 1, 1, 0},
+		{"/$bunfs/root/a.js", "x('é')", 1, 2, 0},
+		{"/$bunfs/root/a.js", "x('\xff')", 1, 0, 0},
+		{"/$bunfs/root/a.mjs", "x()", 1, 1, 1},
+		{"/$bunfs/root/a.cts", "x()", 2, 1, 2},
+		{`B:\~BUN\root\a.TSX`, "x()", 3, 1, 0},
+		{"/$bunfs/root/a.json", "{}", 6, 0, 0},
+		{"/$bunfs/root/a.bin", "\x00", 5, 0, 0},
+	}
+	for _, tt := range tests {
+		f := NewGraphFile(tt.name, []byte(tt.contents))
+		if f.Loader != tt.wantLoader || f.Encoding != tt.wantEncoding || f.ModuleFormat != tt.wantFormat {
+			t.Errorf("NewGraphFile(%q, %q) = loader %d, encoding %d, format %d; want %d, %d, %d",
+				tt.name, tt.contents, f.Loader, f.Encoding, f.ModuleFormat, tt.wantLoader, tt.wantEncoding, tt.wantFormat)
+		}
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	g := testGraph()
+	n := len(g.Files)
+	f := NewGraphFile("/$bunfs/root/claudeload/extra.js", []byte("export {};\n"))
+	idx, err := g.AddFile(f)
+	if err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if idx != n || g.EntryPointID != testGraph().EntryPointID {
+		t.Errorf("AddFile = %d with entry point %d, want %d with it unchanged", idx, g.EntryPointID, n)
+	}
+
+	// The new module survives serialization.
+	got, err := loadBytes(t, buildExe(t, "runtime", g)).Graph()
+	if err != nil {
+		t.Fatalf("Graph: %v", err)
+	}
+	assertSameGraph(t, got, g)
+
+	for _, tt := range []struct {
+		name    string
+		wantErr string
+	}{
+		{"/$bunfs/root/claudeload/extra.js", "already exists"},
+		{"/tmp/extra.js", "not under"},
+		{"extra.js", "not under"},
+	} {
+		if _, err := g.AddFile(NewGraphFile(tt.name, nil)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("AddFile(%q) = %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+	if len(g.Files) != n+1 {
+		t.Errorf("%d modules after rejected adds, want %d", len(g.Files), n+1)
+	}
+}
+
+func TestReplaceContents(t *testing.T) {
+	tests := []struct {
+		name         string
+		module       int
+		contents     string
+		sourceMap    string
+		wantEncoding uint8
+	}{
+		{"drops derived data", 1, "run()", "", 2},
+		{"keeps a new source map", 1, "run()", `{"version":3}`, 2},
+		{"utf8 stays utf8 for ASCII", 0, "ascii()", "", 2},
+		{"utf8 for non-ASCII", 0, "x('é')", "", 2},
+		{"latin1 becomes utf8", 3, "x('é')", "", 2},
+		{"binary for invalid UTF-8", 0, "x('\xff')", "", 0},
+		{"non-source keeps its encoding", 2, `{"y":2}`, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGraph()
+			g.Files[3] = NewGraphFile("/$bunfs/root/latin1.js", []byte("x()"))
+			want := g.Files[tt.module]
+
+			if err := g.ReplaceContents(tt.module, []byte(tt.contents), []byte(tt.sourceMap)); err != nil {
+				t.Fatalf("ReplaceContents: %v", err)
+			}
+			f := g.Files[tt.module]
+			if string(f.Contents) != tt.contents || string(f.SourceMap) != tt.sourceMap {
+				t.Errorf("contents %q, source map %q; want %q, %q", f.Contents, f.SourceMap, tt.contents, tt.sourceMap)
+			}
+			if f.Bytecode != nil || f.BytecodeOriginPath != nil || f.ModuleInfo != nil {
+				t.Errorf("kept bytecode %d bytes, origin %q, module info %v", len(f.Bytecode), f.BytecodeOriginPath, f.ModuleInfo)
+			}
+			if f.Encoding != tt.wantEncoding {
+				t.Errorf("encoding = %d, want %d", f.Encoding, tt.wantEncoding)
+			}
+			if f.Name != want.Name || f.Loader != want.Loader || f.ModuleFormat != want.ModuleFormat || f.Side != want.Side {
+				t.Errorf("module metadata changed: %+v", f)
+			}
+		})
+	}
+
+	g := testGraph()
+	if err := g.ReplaceContents(len(g.Files), nil, nil); err == nil {
+		t.Error("ReplaceContents accepted an index out of range")
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     uint32
+		remove    int
+		wantEntry uint32
+		wantErr   string
+	}{
+		{"before the entry point", 2, 0, 1, ""},
+		{"after the entry point", 1, 3, 1, ""},
+		{"the entry point", 1, 1, 1, "entry point"},
+		{"out of range", 1, 4, 1, "out of range"},
+		{"negative", 1, -1, 1, "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGraph()
+			g.EntryPointID = tt.entry
+			entryName := g.Files[tt.entry].Name
+			n := len(g.Files)
+
+			err := g.RemoveFile(tt.remove)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RemoveFile(%d) = %v, want %q", tt.remove, err, tt.wantErr)
+				}
+				if len(g.Files) != n {
+					t.Errorf("%d modules after a failed remove, want %d", len(g.Files), n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RemoveFile(%d): %v", tt.remove, err)
+			}
+			if len(g.Files) != n-1 {
+				t.Errorf("%d modules, want %d", len(g.Files), n-1)
+			}
+			if g.EntryPointID != tt.wantEntry || g.Files[g.EntryPointID].Name != entryName {
+				t.Errorf("entry point = %d (%s), want %d (%s)", g.EntryPointID, g.Files[g.EntryPointID].Name, tt.wantEntry, entryName)
+			}
+
+			// The shifted entry point survives serialization.
+			got, err := loadBytes(t, buildExe(t, "runtime", g)).Graph()
+			if err != nil {
+				t.Fatalf("Graph: %v", err)
+			}
+			assertSameGraph(t, got, g)
+		})
+	}
+}
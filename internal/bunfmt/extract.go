@@ -1,25 +1,85 @@
 package bunfmt
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
+
+	"claudeload/internal/jsbeautify"
+	"claudeload/internal/sourcemap"
 )
 
 type ExtractOptions struct {
-	Beautify bool //
-	Verbose  bool
+	Beautify   bool   // also write a beautified copy of each JS/TS module
+	Beautifier string // one of Beautifiers; default: the built-in one
+	Strict     bool   // refuse to extract graphs that fail Validate
+	Verbose    bool
+	OutputDir  string       // directory or archive; default: ./<base>_extracted[.<format>]
+	Format     string       // one of ExtractFormats; default: by OutputDir's extension
+	Filter     ModuleFilter // modules to write; the rest are listed as skipped
+	Jobs       int          // modules processed at once; default: GOMAXPROCS
+
+	// FromSourceMaps also writes the original sources that modules' source
+	// maps carry, under sources/ at their paths in the map.
+	FromSourceMaps bool
 }
 
-func ExtractBunExe(exePath string, opts ExtractOptions) error {
-	logv := func(format string, args ...any) {
-		if opts.Verbose {
-			fmt.Printf(format, args...)
+// ModuleError is a problem extracting one module.
+type ModuleError struct {
+	Module int
+	Name   string
+	Err    error
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("[%d] %s: %v", e.Module, orEmpty(e.Name), e.Err)
+}
+
+func (e *ModuleError) Unwrap() error {
+	return e.Err
+}
+
+// PartialExtractError is returned by ExtractBunExe when some modules could
+// not be fully extracted. Everything else, the manifest included, has still
+// been written. Problems holds *ModuleError values in module order.
+type PartialExtractError struct {
+	Failed   int // modules with at least one problem
+	Problems []error
+}
+
+func (e *PartialExtractError) Error() string {
+	noun := "modules"
+	if e.Failed == 1 {
+		noun = "module"
+	}
+	return fmt.Sprintf("%d %s could not be fully extracted", e.Failed, noun)
+}
+
+func (e *PartialExtractError) Unwrap() []error {
+	return e.Problems
+}
+
+// ExtractBunExe writes the modules of the executable at exePath and a
+// manifest describing them. Problems with individual modules do not stop the
+// extraction; they are returned together as a *PartialExtractError.
+func ExtractBunExe(exePath string, opts ExtractOptions) (err error) {
+	if opts.Beautify && opts.Beautifier == "js-beautify" {
+		if _, err := exec.LookPath("js-beautify"); err != nil {
+			return fmt.Errorf("js-beautify not found in PATH")
 		}
 	}
 
@@ -27,22 +87,285 @@ func ExtractBunExe(exePath string, opts ExtractOptions) error {
 	if err != nil {
 		return err
 	}
+	defer exe.Close()
+	if opts.Strict {
+		if err := exe.Validate(); err != nil {
+			return err
+		}
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = ExtractFormatForPath(opts.OutputDir)
+	}
+	output := opts.OutputDir
+	if output == "" {
+		output = filepath.Join(".", filepath.Base(exePath)+"_extracted")
+		if format != "dir" {
+			output += "." + format
+		}
+	}
+	fmt.Printf("[*] Extracting to: %s\n", output)
+	sink, err := newExtractSink(format, output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := sink.Close(); err == nil {
+			err = cerr
+		}
+		var partial *PartialExtractError
+		if err != nil && format != "dir" && !errors.As(err, &partial) {
+			os.Remove(output)
+		}
+	}()
+
+	argv, err := exe.ReadPointer(exe.Offsets.CompileExecArgvPtr)
+	if err != nil {
+		return fmt.Errorf("reading compile_exec_argv: %w", err)
+	}
+	sourceSum, err := sourceSHA256(exe.Src)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", exePath, err)
+	}
+	manifest := ExtractManifest{
+		Version:         ExtractManifestVersion,
+		SourceSHA256:    sourceSum,
+		Layout:          exe.Layout.Name,
+		EntryPointID:    exe.Offsets.EntryPointID,
+		CompileExecArgv: string(argv),
+		Flags:           exe.Offsets.Flags,
+		Modules:         make([]ExtractedModule, 0, exe.NumModules),
+	}
+	if !exe.BunVersion.IsZero() {
+		manifest.BunVersion = exe.BunVersion.String()
+	}
+	// Modules are planned in order, processed by a pool of workers, and
+	// written in order again, so the output does not depend on scheduling.
+	jobs, err := planExtraction(exe, opts)
+	if err != nil {
+		return err
+	}
+	n := opts.Jobs
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	queue := make(chan *extractJob)
+	window := make(chan struct{}, 2*n) // bounds the jobs held ahead of the writer
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait() // workers read from exe, which is closed after this
+	defer close(stop)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+		for _, j := range jobs {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case queue <- j:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				j.run(exe, opts)
+				close(j.done)
+			}
+		}()
+	}
+
+	used := make(map[string]bool)
+	for _, j := range jobs {
+		used[j.savePath] = true
+	}
+	sources := make(map[string]string) // path of each source written -> SHA-256
+	var problems []error
+	failed := 0
+	count, skipped, recovered := 0, 0, 0
+	for _, j := range jobs {
+		<-j.done
+		em, name, savePath := &j.em, j.em.Name, j.savePath
+		logv := j.logf(opts.Verbose)
+		hadProblem := false
+		problem := func(format string, args ...any) {
+			problems = append(problems, &ModuleError{Module: em.Index, Name: name, Err: fmt.Errorf(format, args...)})
+			if !hadProblem {
+				hadProblem = true
+				failed++
+			}
+		}
+
+		switch {
+		case em.Skipped:
+			skipped++
+		case j.contentErr != nil:
+			problem("reading contents: %v", j.contentErr)
+		case len(j.content) == 0:
+			logv("  -> skipped (0 bytes)\n")
+		default:
+			if err := sink.WriteFile(savePath, name, j.content); err != nil {
+				return err
+			}
+			logv("  -> saved %d bytes to %s\n", len(j.content), savePath)
+			em.File = savePath
+			count++
+		}
+
+		if j.beautifyErr != nil {
+			problem("beautify: %v", j.beautifyErr)
+		} else if j.beautified != nil {
+			outPath := savePath + ".beautified.js"
+			if err := sink.WriteFile(outPath, name, j.beautified); err != nil {
+				return err
+			}
+			logv("  -> beautified output: %s\n", outPath)
+			em.Beautified = outPath
+			em.BeautifiedSHA256 = sha256Hex(j.beautified)
+		}
+
+		for _, side := range []struct {
+			sp   StringPointer
+			ext  string
+			what string
+			dst  *string
+		}{
+			{j.mod.SourceMap, ".map", "source map", &em.SourceMap},
+			{j.mod.Bytecode, ".bytecode", "bytecode", &em.Bytecode},
+			{j.mod.ModuleInfo, ".module_info", "module info", &em.ModuleInfo},
+		} {
+			if em.Skipped || side.sp.Length == 0 {
+				continue
+			}
+			data, err := exe.ReadPointer(side.sp)
+			if err != nil {
+				problem("reading %s: %v", side.what, err)
+				continue
+			}
+			if err := sink.WriteFile(savePath+side.ext, name, data); err != nil {
+				return err
+			}
+			*side.dst = savePath + side.ext
+		}
+		// A module_info that could not be read has been reported already.
+		if em.ModuleInfo != "" {
+			if info, err := exe.ModuleInfo(j.mod); err != nil {
+				problem("%v", err)
+			} else {
+				em.ModuleInfoRecords = info
+			}
+		}
+
+		if j.sourcesErr != nil {
+			problem("reading the sources in its source map: %v", j.sourcesErr)
+		}
+		for k, src := range j.sources {
+			if src.Contents == nil {
+				logv("  -> source %s: not in the source map\n", orEmpty(src.Name))
+				continue
+			}
+			p := sourceOutputPath(src.Name, k)
+			sum := sha256Hex(src.Contents)
+			// Sources of different modules can share a path but not
+			// contents, e.g. two copies of a dependency.
+			for n := 0; used[p] && sources[p] != sum; n++ {
+				ext := path.Ext(p)
+				base := strings.TrimSuffix(sourceOutputPath(src.Name, k), ext)
+				if n == 0 {
+					p = fmt.Sprintf("%s.%d%s", base, em.Index, ext)
+				} else {
+					p = fmt.Sprintf("%s.%d_%d%s", base, em.Index, n, ext)
+				}
+			}
+			em.Sources = append(em.Sources, p)
+			if _, ok := sources[p]; ok {
+				continue // another module's map carries the same file
+			}
+			if err := sink.WriteFile(p, name, src.Contents); err != nil {
+				return err
+			}
+			used[p], sources[p] = true, sum
+			logv("  -> source %s: %s\n", src.Name, p)
+			recovered++
+		}
+
+		os.Stdout.Write(j.log.Bytes())
+		manifest.Modules = append(manifest.Modules, *em)
+		*j = extractJob{} // let the collector have the contents
+		<-window
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := sink.WriteFile(ExtractManifestName, "", append(data, '\n')); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	if skipped > 0 {
+		fmt.Printf("[*] Extracted %d files, skipped %d modules.\n", count, skipped)
+	} else {
+		fmt.Printf("[*] Extracted %d files.\n", count)
+	}
+	if opts.FromSourceMaps {
+		fmt.Printf("[*] Recovered %d source files from source maps.\n", recovered)
+	}
+	if len(problems) > 0 {
+		return &PartialExtractError{Failed: failed, Problems: problems}
+	}
+	return nil
+}
+
+// extractJob is one module on its way through ExtractBunExe.
+// planExtraction fills in the module's entry and where it goes; run, on a
+// worker, does the expensive part.
+type extractJob struct {
+	em       ExtractedModule
+	mod      ModuleStruct
+	savePath string
+	log      bytes.Buffer // verbose output, printed when the module is written
+	done     chan struct{}
 
-	outputDir := filepath.Join(".", filepath.Base(exePath)+"_extracted")
-	fmt.Printf("[*] Extracting to: %s\n", outputDir)
-	if err := os.MkdirAll(outputDir, 0o755); err != nil {
-		return fmt.Errorf("creating output directory: %w", err)
+	content     []byte
+	contentErr  error
+	beautified  []byte
+	beautifyErr error
+	sources     []sourcemap.Source
+	sourcesErr  error
+}
+
+func (j *extractJob) logf(verbose bool) func(format string, args ...any) {
+	return func(format string, args ...any) {
+		if verbose {
+			fmt.Fprintf(&j.log, format, args...)
+		}
 	}
+}
 
-	count := 0
-	for i := 0; i < exe.NumModules; i++ {
+// planExtraction lists the modules of exe with their manifest entries and
+// output paths.
+func planExtraction(exe *ExecutableData, opts ExtractOptions) ([]*extractJob, error) {
+	jobs := make([]*extractJob, exe.NumModules)
+	used := make(map[string]bool)
+	for i := range jobs {
 		mod, err := exe.GetModule(i)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
+		j := &extractJob{mod: mod, done: make(chan struct{})}
+		jobs[i] = j
+		logv := j.logf(opts.Verbose)
 		name := exe.GetModuleName(mod)
-		content := exe.GetModuleContent(mod)
 
 		encName := EncodingName[mod.Encoding]
 		if encName == "" {
@@ -63,64 +386,68 @@ func ExtractBunExe(exePath string, opts ExtractOptions) error {
 		logv("  module_format:        %d\n", mod.ModuleFormat)
 		logv("  side:                 %d\n", mod.Side)
 
-		if len(content) == 0 {
-			logv("  -> skipped (0 bytes)\n")
-			continue
-		}
-
-		savePath := resolveOutputPath(outputDir, name, mod.Loader, i)
-
-		if err := os.MkdirAll(filepath.Dir(savePath), 0o755); err != nil {
-			return err
+		j.em = ExtractedModule{
+			Index:        i,
+			Name:         name,
+			Loader:       enumName(LoaderName, mod.Loader),
+			Encoding:     enumName(EncodingName, mod.Encoding),
+			ModuleFormat: enumName(ModuleFormatName, mod.ModuleFormat),
+			Side:         enumName(SideName, mod.Side),
+			Struct:       extractedStruct(mod),
 		}
-		if err := os.WriteFile(savePath, content, 0o644); err != nil {
-			return err
+		if origin, err := exe.ReadPointer(mod.BytecodeOriginPath); err == nil {
+			j.em.BytecodeOriginPath = string(origin)
 		}
-		logv("  -> saved %d bytes to %s\n", len(content), savePath)
-		count++
 
-		if opts.Beautify && mod.Loader <= 3 {
-			logv("  -> beautifying %s...\n", filepath.Base(savePath))
-			if beautified, err := beautifyJS(content); err == nil {
-				outPath := savePath + ".beautified.js"
-				if err := os.WriteFile(outPath, beautified, 0o644); err != nil {
-					fmt.Fprintf(os.Stderr, "[!] failed to write beautified output: %v\n", err)
-				} else {
-					logv("  -> beautified output: %s\n", outPath)
-				}
-			} else {
-				logv("  -> beautify skipped: %v\n", err)
-			}
+		if !opts.Filter.Match(name, mod.Loader) {
+			logv("  -> skipped (filtered out)\n")
+			j.em.Skipped = true
+			continue
 		}
 
-		if mod.SourceMap.Length > 0 {
-			mapData := mod.SourceMap.Read(exe.Blob)
-			if err := os.WriteFile(savePath+".map", mapData, 0o644); err != nil {
-				fmt.Fprintf(os.Stderr, "[!] failed to write source map for %s: %v\n", filepath.Base(savePath), err)
-			}
+		// Names that differ only in characters the sanitizer replaces would
+		// otherwise overwrite each other. Paths within the output are
+		// slash-separated whatever the format.
+		savePath := filepath.ToSlash(resolveOutputPath("", name, mod.Loader, i))
+		if used[savePath] {
+			ext := path.Ext(savePath)
+			savePath = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(savePath, ext), i, ext)
 		}
+		used[savePath] = true
+		j.savePath = savePath
+	}
+	return jobs, nil
+}
 
-		if mod.Bytecode.Length > 0 {
-			bcData := mod.Bytecode.Read(exe.Blob)
-			if err := os.WriteFile(savePath+".bytecode", bcData, 0o644); err != nil {
-				fmt.Fprintf(os.Stderr, "[!] failed to write bytecode for %s: %v\n", filepath.Base(savePath), err)
-			}
+// run reads the module's contents and does the work that does not depend on
+// other modules: hashing, beautifying and reading its source map.
+func (j *extractJob) run(exe *ExecutableData, opts ExtractOptions) {
+	content, err := exe.ReadPointer(j.mod.Contents)
+	if err != nil {
+		j.contentErr = err
+	} else {
+		j.em.SHA256 = sha256Hex(content)
+	}
+	if j.em.Skipped {
+		return
+	}
+	j.content = content
+	if opts.Beautify && IsSourceLoader(j.mod.Loader) && len(content) > 0 {
+		j.beautified, j.beautifyErr = beautifyJS(content, opts.Beautifier)
+	}
+	if opts.FromSourceMaps && j.mod.SourceMap.Length > 0 {
+		sm, err := exe.ReadPointer(j.mod.SourceMap)
+		if err == nil {
+			j.sources, err = sourcemap.Sources(sm)
 		}
+		j.sourcesErr = err
 	}
-
-	fmt.Printf("[*] Extracted %d files.\n", count)
-	return nil
 }
 
 func resolveOutputPath(outputDir, name string, loader uint8, index int) string {
 	clean := name
 
-	for _, prefix := range []string{"/$bunfs/", `B:\~BUN\`} {
-		if strings.HasPrefix(clean, prefix) {
-			clean = clean[len(prefix):]
-			break
-		}
-	}
+	clean = strings.TrimPrefix(clean, ModuleRoot(clean))
 
 	clean = strings.TrimLeft(clean, "/\\")
 	if idx := strings.Index(clean, ":"); idx >= 0 {
@@ -132,6 +459,9 @@ func resolveOutputPath(outputDir, name string, loader uint8, index int) string {
 	})
 	sanitized := make([]string, 0, len(parts))
 	for _, part := range parts {
+		if part == "." || part == ".." {
+			continue
+		}
 		part = sanitizePathComponent(part)
 		if part != "" {
 			sanitized = append(sanitized, part)
@@ -156,6 +486,34 @@ func resolveOutputPath(outputDir, name string, loader uint8, index int) string {
 	return filepath.Join(outputDir, joined)
 }
 
+// sourceOutputPath places the source called name in a source map under
+// sources/. URL schemes, drive letters and leading ../ are dropped, so that
+// sources land at their path relative to the project, e.g.
+// "../../src/tools/BashTool.ts" becomes sources/src/tools/BashTool.ts.
+func sourceOutputPath(name string, index int) string {
+	clean := strings.ReplaceAll(name, `\`, "/")
+	if i := strings.Index(clean, "://"); i >= 0 {
+		clean = clean[i+3:]
+	} else if i := strings.IndexByte(clean, ':'); i == 1 {
+		clean = clean[2:] // drive letter
+	} else if i > 0 && !strings.Contains(clean[:i], "/") {
+		clean = clean[:i] + "/" + clean[i+1:] // e.g. bun:wrap
+	}
+	var parts []string
+	for _, part := range strings.Split(clean, "/") {
+		if part == "." || part == ".." {
+			continue
+		}
+		if part = sanitizePathComponent(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("sources/source_%d", index)
+	}
+	return "sources/" + strings.Join(parts, "/")
+}
+
 func sanitizePathComponent(s string) string {
 	var b strings.Builder
 	for _, r := range s {
@@ -188,7 +546,21 @@ func orEmpty(s string) string {
 	return s
 }
 
-func beautifyJS(src []byte) ([]byte, error) {
+// Beautifiers are the backends ExtractOptions.Beautifier can name: the
+// built-in pretty-printer, or js-beautify from PATH.
+var Beautifiers = []string{"builtin", "js-beautify"}
+
+func beautifyJS(src []byte, backend string) ([]byte, error) {
+	switch backend {
+	case "", "builtin":
+		return jsbeautify.Beautify(src)
+	case "js-beautify":
+		return runJSBeautify(src)
+	}
+	return nil, fmt.Errorf("unknown beautifier %q", backend)
+}
+
+func runJSBeautify(src []byte) ([]byte, error) {
 	path, err := exec.LookPath("js-beautify")
 	if err != nil {
 		return nil, fmt.Errorf("js-beautify not found in PATH")
@@ -209,3 +581,11 @@ func beautifyJS(src []byte) ([]byte, error) {
 	}
 	return out, nil
 }
+
+func sourceSHA256(src Source) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(src, 0, src.Size())); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,77 @@
+package bunfmt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readTree returns the files under dir by slash-separated relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtractReportsFailedModules(t *testing.T) {
+	g := testGraph()
+	g.Files[1].ModuleInfo = nil // not a valid module_info
+	data := buildExe(t, "runtime", g)
+
+	// Point the contents of module 0 and the source map of module 2 past
+	// the end of the blob.
+	rewriteTables(t, data, func(mods []ModuleStruct, o *OffsetsStruct) {
+		mods[0].Contents = StringPointer{Offset: 0, Length: 1 << 20}
+		mods[2].SourceMap = StringPointer{Offset: 0, Length: 1 << 20}
+	})
+
+	dir := t.TempDir()
+	exePath := filepath.Join(dir, "claude")
+	if err := os.WriteFile(exePath, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var first map[string]string
+	for _, jobs := range []int{1, 4} {
+		out := filepath.Join(dir, "out", string(rune('0'+jobs)))
+		err := ExtractBunExe(exePath, ExtractOptions{OutputDir: out, Jobs: jobs})
+		var perr *PartialExtractError
+		if !errors.As(err, &perr) {
+			t.Fatalf("jobs=%d: ExtractBunExe = %v, want a *PartialExtractError", jobs, err)
+		}
+		var modules []int
+		for _, p := range perr.Problems {
+			var merr *ModuleError
+			if errors.As(p, &merr) {
+				modules = append(modules, merr.Module)
+			}
+		}
+		if perr.Failed != 2 || !reflect.DeepEqual(modules, []int{0, 2}) {
+			t.Errorf("jobs=%d: problems = %v, want one each for modules 0 and 2", jobs, perr.Problems)
+		}
+
+		files := readTree(t, out)
+		if _, ok := files[ExtractManifestName]; !ok {
+			t.Errorf("jobs=%d: manifest not written", jobs)
+		}
+		if first == nil {
+			first = files
+		} else if !reflect.DeepEqual(files, first) {
+			t.Errorf("jobs=%d: output differs from jobs=1", jobs)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package bunfmt
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ModuleFilter selects modules by name and loader. Patterns are globs over
+// slash-separated module names: * and ? stay within a path segment, **
+// spans segments, and a pattern without a slash matches the base name, so
+// "*.js" selects every JavaScript file. Patterns may also be written
+// relative to the graph root, e.g. "root/node_modules/**". An empty filter
+// selects everything.
+type ModuleFilter struct {
+	Include []string
+	Exclude []string
+	Loaders []uint8 // empty means any loader
+
+	include, exclude []*regexp.Regexp
+}
+
+// Compile checks the patterns. Match compiles them on first use, so calling
+// Compile is only needed to report bad patterns early.
+func (f *ModuleFilter) Compile() error {
+	var err error
+	if f.include, err = compileGlobs(f.Include); err != nil {
+		return err
+	}
+	f.exclude, err = compileGlobs(f.Exclude)
+	return err
+}
+
+// Match reports whether the module called name with the given loader is
+// selected.
+func (f *ModuleFilter) Match(name string, loader uint8) bool {
+	if f.include == nil && f.exclude == nil && f.Compile() != nil {
+		return false
+	}
+	if len(f.Loaders) > 0 && !slices.Contains(f.Loaders, loader) {
+		return false
+	}
+	name = strings.ReplaceAll(name, `\`, "/")
+	rel := name
+	for _, root := range ModuleRoots {
+		rel = strings.TrimPrefix(rel, strings.ReplaceAll(root, `\`, "/"))
+	}
+	base := name[strings.LastIndexByte(name, '/')+1:]
+	matches := func(res []*regexp.Regexp) bool {
+		for _, re := range res {
+			if re.MatchString(name) || re.MatchString(rel) || re.MatchString(base) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(f.include) > 0 && !matches(f.include) {
+		return false
+	}
+	return !matches(f.exclude)
+}
+
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := globRegexp(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// globRegexp translates a glob into an anchored regular expression.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("glob %q: unterminated [", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			if c >= 0x80 {
+				b.WriteByte(c) // part of a UTF-8 sequence
+			} else {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("glob %q: %w", pattern, err)
+	}
+	return re, nil
+}
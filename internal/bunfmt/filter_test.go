@@ -0,0 +1,56 @@
+package bunfmt
+
+import "testing"
+
+func TestModuleFilter(t *testing.T) {
+	const (
+		loaderJS   = 1
+		loaderJSON = 6
+	)
+	tests := []struct {
+		name   string
+		filter ModuleFilter
+		module string
+		loader uint8
+		want   bool
+	}{
+		{"empty filter", ModuleFilter{}, "/$bunfs/root/cli.js", loaderJS, true},
+		{"base name glob", ModuleFilter{Include: []string{"*.js"}}, "/$bunfs/root/lib/a.js", loaderJS, true},
+		{"base name glob misses", ModuleFilter{Include: []string{"*.js"}}, "/$bunfs/root/data.json", loaderJSON, false},
+		{"star stays in segment", ModuleFilter{Include: []string{"root/*.js"}}, "/$bunfs/root/lib/a.js", loaderJS, false},
+		{"double star spans segments", ModuleFilter{Include: []string{"root/**/*.js"}}, "/$bunfs/root/lib/x/a.js", loaderJS, true},
+		{"double star matches no segment", ModuleFilter{Include: []string{"root/**/a.js"}}, "/$bunfs/root/a.js", loaderJS, true},
+		{"relative to the graph root", ModuleFilter{Include: []string{"root/node_modules/**"}}, "/$bunfs/root/node_modules/x/i.js", loaderJS, true},
+		{"full name", ModuleFilter{Include: []string{"/$bunfs/root/cli.js"}}, "/$bunfs/root/cli.js", loaderJS, true},
+		{"windows root", ModuleFilter{Include: []string{"root/*.js"}}, `B:\~BUN\root\cli.js`, loaderJS, true},
+		{"question mark", ModuleFilter{Include: []string{"?.js"}}, "/$bunfs/root/a.js", loaderJS, true},
+		{"question mark is one character", ModuleFilter{Include: []string{"?.js"}}, "/$bunfs/root/ab.js", loaderJS, false},
+		{"class", ModuleFilter{Include: []string{"[ab].js"}}, "/$bunfs/root/b.js", loaderJS, true},
+		{"negated class", ModuleFilter{Include: []string{"[!ab].js"}}, "/$bunfs/root/b.js", loaderJS, false},
+		{"dot is literal", ModuleFilter{Include: []string{"a.js"}}, "/$bunfs/root/axjs", loaderJS, false},
+		{"exclude wins", ModuleFilter{Include: []string{"*.js"}, Exclude: []string{"root/node_modules/**"}}, "/$bunfs/root/node_modules/x.js", loaderJS, false},
+		{"exclude only", ModuleFilter{Exclude: []string{"*.json"}}, "/$bunfs/root/cli.js", loaderJS, true},
+		{"loader", ModuleFilter{Loaders: []uint8{loaderJSON}}, "/$bunfs/root/cli.js", loaderJS, false},
+		{"loader and glob", ModuleFilter{Include: []string{"*.json"}, Loaders: []uint8{loaderJSON}}, "/$bunfs/root/data.json", loaderJSON, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Compile(); err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got := tt.filter.Match(tt.module, tt.loader); got != tt.want {
+				t.Errorf("Match(%q) = %t, want %t", tt.module, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleFilterBadPattern(t *testing.T) {
+	f := ModuleFilter{Include: []string{"[abc"}}
+	if err := f.Compile(); err == nil {
+		t.Error("Compile succeeded, want an error")
+	}
+	if f.Match("/$bunfs/root/a.js", 1) {
+		t.Error("a filter with a bad pattern matched")
+	}
+}
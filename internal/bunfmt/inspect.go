@@ -0,0 +1,117 @@
+package bunfmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Report is a structured summary of an executable's module graph, suitable
+// for printing or JSON encoding.
+type Report struct {
+	Path            string         `json:"path"`
+	BunVersion      string         `json:"bun_version,omitempty"`
+	Layout          string         `json:"layout"`
+	Section         *Section       `json:"section,omitempty"`
+	TrailerOffset   int64          `json:"trailer_offset"`
+	BlobStart       int64          `json:"blob_start"`
+	BlobEnd         int64          `json:"blob_end"`
+	ByteCount       uint64         `json:"byte_count"`
+	EntryPointID    uint32         `json:"entry_point_id"`
+	EntryPoint      string         `json:"entry_point"`
+	CompileExecArgv string         `json:"compile_exec_argv"`
+	Flags           uint32         `json:"flags"`
+	Modules         []ModuleReport `json:"modules"`
+}
+
+// ModuleReport describes one module of the graph.
+type ModuleReport struct {
+	Index          int    `json:"index"`
+	Name           string `json:"name"`
+	Loader         string `json:"loader"`
+	Encoding       string `json:"encoding"`
+	Format         string `json:"format"`
+	Side           string `json:"side"`
+	ContentsSize   uint32 `json:"contents_size"`
+	SourceMapSize  uint32 `json:"sourcemap_size"`
+	BytecodeSize   uint32 `json:"bytecode_size"`
+	ModuleInfoSize uint32 `json:"module_info_size"`
+
+	// ModuleInfo is the decoded module info, filled in by AddModuleInfo,
+	// or ModuleInfoError why it could not be decoded.
+	ModuleInfo      *ModuleInfo `json:"module_info,omitempty"`
+	ModuleInfoError string      `json:"module_info_error,omitempty"`
+}
+
+// Inspect summarizes exe. path is recorded in the report as given.
+func (exe *ExecutableData) Inspect(path string) (*Report, error) {
+	argv, err := exe.ReadPointer(exe.Offsets.CompileExecArgvPtr)
+	if err != nil {
+		return nil, fmt.Errorf("reading compile_exec_argv: %w", err)
+	}
+	r := &Report{
+		Path:            path,
+		Layout:          exe.Layout.Name,
+		Section:         exe.Section,
+		TrailerOffset:   exe.TrailerPos,
+		BlobStart:       exe.BlobStart,
+		BlobEnd:         exe.BlobStart + int64(exe.Offsets.ByteCount),
+		ByteCount:       exe.Offsets.ByteCount,
+		EntryPointID:    exe.Offsets.EntryPointID,
+		CompileExecArgv: strings.ToValidUTF8(string(argv), "?"),
+		Flags:           exe.Offsets.Flags,
+		Modules:         make([]ModuleReport, 0, exe.NumModules),
+	}
+	if !exe.BunVersion.IsZero() {
+		r.BunVersion = exe.BunVersion.String()
+	}
+
+	for i := 0; i < exe.NumModules; i++ {
+		m, err := exe.GetModule(i)
+		if err != nil {
+			return nil, err
+		}
+		name := exe.GetModuleName(m)
+		if i == int(exe.Offsets.EntryPointID) {
+			r.EntryPoint = name
+		}
+		r.Modules = append(r.Modules, ModuleReport{
+			Index:          i,
+			Name:           name,
+			Loader:         enumName(LoaderName, m.Loader),
+			Encoding:       enumName(EncodingName, m.Encoding),
+			Format:         enumName(ModuleFormatName, m.ModuleFormat),
+			Side:           enumName(SideName, m.Side),
+			ContentsSize:   m.Contents.Length,
+			SourceMapSize:  m.SourceMap.Length,
+			BytecodeSize:   m.Bytecode.Length,
+			ModuleInfoSize: m.ModuleInfo.Length,
+		})
+	}
+	return r, nil
+}
+
+// AddModuleInfo decodes the module info of each module of r, a report on
+// exe.
+func (exe *ExecutableData) AddModuleInfo(r *Report) error {
+	for i := range r.Modules {
+		m, err := exe.GetModule(r.Modules[i].Index)
+		if err != nil {
+			return err
+		}
+		info, err := exe.ModuleInfo(m)
+		if err != nil {
+			r.Modules[i].ModuleInfoError = err.Error()
+			continue
+		}
+		r.Modules[i].ModuleInfo = info
+	}
+	return nil
+}
+
+// enumName looks v up in names, falling back to its decimal value.
+func enumName(names map[uint8]string, v uint8) string {
+	if s, ok := names[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("%d", v)
+}
@@ -0,0 +1,266 @@
+package bunfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Layout describes the wire format of one generation of Bun's standalone
+// module graph. Bun has grown CompiledModuleGraphFile and the offsets struct
+// over time by appending fields, so each generation is described by how many
+// of the known fields it carries rather than by a bespoke decoder.
+type Layout struct {
+	Name string
+	// MinVersion is the first Bun release known to write this layout.
+	MinVersion Version
+	// ModulePointers is how many StringPointers lead each module entry, in the
+	// order name, contents, sourcemap, bytecode, module_info,
+	// bytecode_origin_path.
+	ModulePointers int
+	// ModuleBytes is how many u8 fields follow them, in the order encoding,
+	// loader, module_format, side.
+	ModuleBytes int
+	// HasExecArgv and HasFlags report whether the offsets struct carries
+	// compile_exec_argv_ptr and flags after entry_point_id.
+	HasExecArgv bool
+	HasFlags    bool
+}
+
+// Layouts is the registry of known layouts, newest first.
+var Layouts = []*Layout{
+	{
+		Name:           "v1.3",
+		MinVersion:     Version{1, 3, 0},
+		ModulePointers: 6,
+		ModuleBytes:    4,
+		HasExecArgv:    true,
+		HasFlags:       true,
+	},
+	{
+		Name:           "v1.1",
+		MinVersion:     Version{1, 1, 30},
+		ModulePointers: 4,
+		ModuleBytes:    4,
+		HasExecArgv:    true,
+	},
+	{
+		Name:           "v1.0",
+		MinVersion:     Version{1, 0, 0},
+		ModulePointers: 3,
+		ModuleBytes:    2,
+	},
+}
+
+// LatestLayout is the layout written by current Bun releases.
+var LatestLayout = Layouts[0]
+
+// ModuleStructSize returns the size of one module entry, padded to the 4-byte
+// alignment of its StringPointers.
+func (l *Layout) ModuleStructSize() int {
+	return alignUp(l.ModulePointers*8+l.ModuleBytes, 4)
+}
+
+// OffsetsStructSize returns the size of the offsets struct, padded to the
+// 8-byte alignment of byte_count.
+func (l *Layout) OffsetsStructSize() int {
+	n := 8 + 8 + 4
+	if l.HasExecArgv {
+		n += 8
+	}
+	if l.HasFlags {
+		n += 4
+	}
+	return alignUp(n, 8)
+}
+
+func (l *Layout) String() string {
+	return fmt.Sprintf("%s (module=%d bytes, offsets=%d bytes)", l.Name, l.ModuleStructSize(), l.OffsetsStructSize())
+}
+
+// ReadOffsetsStruct deserializes an offsets struct written in this layout.
+func (l *Layout) ReadOffsetsStruct(data []byte) (OffsetsStruct, error) {
+	if len(data) < l.OffsetsStructSize() {
+		return OffsetsStruct{}, fmt.Errorf("offsets data too short: %d < %d", len(data), l.OffsetsStructSize())
+	}
+	le := binary.LittleEndian
+	o := OffsetsStruct{
+		ByteCount:    le.Uint64(data[0:]),
+		ModulesPtr:   readPointer(data[8:]),
+		EntryPointID: le.Uint32(data[16:]),
+	}
+	if l.HasExecArgv {
+		o.CompileExecArgvPtr = readPointer(data[20:])
+	}
+	if l.HasFlags {
+		o.Flags = le.Uint32(data[28:])
+	}
+	return o, nil
+}
+
+// OffsetsBytes serializes o in this layout. Fields the layout does not carry
+// are dropped.
+func (l *Layout) OffsetsBytes(o OffsetsStruct) []byte {
+	le := binary.LittleEndian
+	out := make([]byte, l.OffsetsStructSize())
+	le.PutUint64(out[0:], o.ByteCount)
+	putPointer(out[8:], o.ModulesPtr)
+	le.PutUint32(out[16:], o.EntryPointID)
+	if l.HasExecArgv {
+		putPointer(out[20:], o.CompileExecArgvPtr)
+	}
+	if l.HasFlags {
+		le.PutUint32(out[28:], o.Flags)
+	}
+	return out
+}
+
+// ReadModuleStruct deserializes one module entry written in this layout.
+func (l *Layout) ReadModuleStruct(data []byte) (ModuleStruct, error) {
+	if len(data) < l.ModuleStructSize() {
+		return ModuleStruct{}, fmt.Errorf("module data too short: %d < %d", len(data), l.ModuleStructSize())
+	}
+	var m ModuleStruct
+	ptrs := m.pointers()
+	for i := 0; i < l.ModulePointers; i++ {
+		*ptrs[i] = readPointer(data[i*8:])
+	}
+	u8s := m.byteFields()
+	for i := 0; i < l.ModuleBytes; i++ {
+		*u8s[i] = data[l.ModulePointers*8+i]
+	}
+	return m, nil
+}
+
+// ModuleStructBytes serializes m in this layout. Fields the layout does not
+// carry are dropped.
+func (l *Layout) ModuleStructBytes(m ModuleStruct) []byte {
+	out := make([]byte, l.ModuleStructSize())
+	ptrs := m.pointers()
+	for i := 0; i < l.ModulePointers; i++ {
+		putPointer(out[i*8:], *ptrs[i])
+	}
+	u8s := m.byteFields()
+	for i := 0; i < l.ModuleBytes; i++ {
+		out[l.ModulePointers*8+i] = *u8s[i]
+	}
+	return out
+}
+
+// pointers returns the module's StringPointers in wire order.
+func (m *ModuleStruct) pointers() []*StringPointer {
+	return []*StringPointer{&m.Name, &m.Contents, &m.SourceMap, &m.Bytecode, &m.ModuleInfo, &m.BytecodeOriginPath}
+}
+
+// byteFields returns the module's u8 fields in wire order.
+func (m *ModuleStruct) byteFields() []*uint8 {
+	return []*uint8{&m.Encoding, &m.Loader, &m.ModuleFormat, &m.Side}
+}
+
+func readPointer(b []byte) StringPointer {
+	return StringPointer{binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])}
+}
+
+func putPointer(b []byte, sp StringPointer) {
+	binary.LittleEndian.PutUint32(b, sp.Offset)
+	binary.LittleEndian.PutUint32(b[4:], sp.Length)
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// LayoutForVersion returns the newest layout whose MinVersion is not after v.
+func LayoutForVersion(v Version) *Layout {
+	for _, l := range Layouts {
+		if !v.Less(l.MinVersion) {
+			return l
+		}
+	}
+	return Layouts[len(Layouts)-1]
+}
+
+// Version is a Bun release number.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Less reports whether v is an earlier release than o.
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+// versionMarker prefixes the runtime's version string, e.g. "Bun v1.2.19".
+var versionMarker = []byte("Bun v")
+
+// DetectBunVersion scans the first limit bytes of r for the runtime's
+// embedded "Bun vX.Y.Z" string and returns the first one found, or the zero
+// Version when there is none. limit should be the start of the module graph
+// so that strings inside bundled modules are never considered.
+func DetectBunVersion(r io.ReaderAt, limit int64) (Version, error) {
+	const overlap = 32
+	chunk := make([]byte, 1<<20)
+	for pos := int64(0); pos < limit; pos += int64(len(chunk) - overlap) {
+		n, err := r.ReadAt(chunk, pos)
+		if err != nil && err != io.EOF {
+			return Version{}, err
+		}
+		buf := chunk[:n]
+		if rem := limit - pos; int64(len(buf)) > rem {
+			buf = buf[:rem]
+		}
+		for off := 0; ; {
+			idx := bytes.Index(buf[off:], versionMarker)
+			if idx < 0 {
+				break
+			}
+			off += idx + len(versionMarker)
+			if v, ok := ParseVersion(buf[off:]); ok {
+				return v, nil
+			}
+		}
+		if n < len(chunk) {
+			break
+		}
+	}
+	return Version{}, nil
+}
+
+// ParseVersion parses a leading "X.Y.Z" from b.
+func ParseVersion(b []byte) (Version, bool) {
+	var parts [3]int
+	for i := range parts {
+		end := 0
+		for end < len(b) && end < 4 && b[end] >= '0' && b[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			return Version{}, false
+		}
+		parts[i], _ = strconv.Atoi(string(b[:end]))
+		b = b[end:]
+		if i < 2 {
+			if len(b) == 0 || b[0] != '.' {
+				return Version{}, false
+			}
+			b = b[1:]
+		}
+	}
+	return Version{parts[0], parts[1], parts[2]}, true
+}
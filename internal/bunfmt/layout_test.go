@@ -0,0 +1,125 @@
+package bunfmt
+
+import "testing"
+
+// graphForLayout returns testGraph trimmed to the fields l can store.
+func graphForLayout(l *Layout) *Graph {
+	g := testGraph()
+	g.Layout = l
+	if !l.HasExecArgv {
+		g.CompileExecArgv = nil
+	}
+	if !l.HasFlags {
+		g.Flags = 0
+	}
+	for i := range g.Files {
+		f := &g.Files[i]
+		ptrs := []*[]byte{nil, nil, nil, &f.Bytecode, &f.ModuleInfo, &f.BytecodeOriginPath}
+		for _, p := range ptrs[l.ModulePointers:] {
+			*p = nil
+		}
+		u8s := []*uint8{&f.Encoding, &f.Loader, &f.ModuleFormat, &f.Side}
+		for _, p := range u8s[l.ModuleBytes:] {
+			*p = 0
+		}
+	}
+	return g
+}
+
+func TestDetectLayout(t *testing.T) {
+	tests := []struct {
+		name        string
+		layout      string
+		runtime     string
+		wantVersion Version
+	}{
+		{"v1.0 without version", "v1.0", "runtime", Version{}},
+		{"v1.1 without version", "v1.1", "runtime", Version{}},
+		{"v1.3 without version", "v1.3", "runtime", Version{}},
+		{"v1.0", "v1.0", "runtime Bun v1.0.14 (linux)", Version{1, 0, 14}},
+		{"v1.1", "v1.1", "runtime Bun v1.1.38 (linux)", Version{1, 1, 38}},
+		{"v1.3", "v1.3", "runtime Bun v1.3.2 (linux)", Version{1, 3, 2}},
+		{"first version wins", "v1.3", "Bun v1.3.2 then Bun v1.0.0", Version{1, 3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := layoutNamed(tt.layout)
+			exe := loadBytes(t, buildExe(t, tt.runtime, graphForLayout(want)))
+			if exe.Layout != want {
+				t.Errorf("layout = %s, want %s", exe.Layout.Name, want.Name)
+			}
+			if exe.BunVersion != tt.wantVersion {
+				t.Errorf("version = %s, want %s", exe.BunVersion, tt.wantVersion)
+			}
+			if exe.NumModules != len(testGraph().Files) {
+				t.Errorf("%d modules, want %d", exe.NumModules, len(testGraph().Files))
+			}
+		})
+	}
+}
+
+// A version string inside a bundled module must not be taken for the
+// runtime's.
+func TestDetectBunVersionIgnoresModules(t *testing.T) {
+	tests := []struct {
+		name        string
+		runtime     string
+		wantVersion Version
+	}{
+		{"no runtime version", "runtime", Version{}},
+		{"runtime version", "runtime Bun v1.3.2", Version{1, 3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGraph()
+			g.Files[0].Contents = []byte(`console.log("built with Bun v1.0.0");`)
+			exe := loadBytes(t, buildExe(t, tt.runtime, g))
+			if exe.BunVersion != tt.wantVersion {
+				t.Errorf("version = %s, want %s", exe.BunVersion, tt.wantVersion)
+			}
+			if exe.Layout != LatestLayout {
+				t.Errorf("layout = %s, want %s", exe.Layout.Name, LatestLayout.Name)
+			}
+		})
+	}
+}
+
+func TestLayoutForVersion(t *testing.T) {
+	tests := []struct {
+		version Version
+		want    string
+	}{
+		{Version{0, 8, 0}, "v1.0"},
+		{Version{1, 0, 0}, "v1.0"},
+		{Version{1, 1, 29}, "v1.0"},
+		{Version{1, 1, 30}, "v1.1"},
+		{Version{1, 2, 19}, "v1.1"},
+		{Version{1, 3, 0}, "v1.3"},
+		{Version{2, 0, 0}, "v1.3"},
+	}
+	for _, tt := range tests {
+		if got := LayoutForVersion(tt.version); got.Name != tt.want {
+			t.Errorf("LayoutForVersion(%s) = %s, want %s", tt.version, got.Name, tt.want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+		ok   bool
+	}{
+		{"1.2.19", Version{1, 2, 19}, true},
+		{"1.3.0 (linux x64)", Version{1, 3, 0}, true},
+		{"1.2", Version{}, false},
+		{"1.x.0", Version{}, false},
+		{"", Version{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseVersion([]byte(tt.in))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseVersion(%q) = %s, %t; want %s, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package bunfmt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrMalformedModuleInfo is wrapped by every error DecodeModuleInfo and
+// ExecutableData.ModuleInfo return. Match it with errors.Is.
+var ErrMalformedModuleInfo = errors.New("malformed module_info")
+
+// ModuleInfo is a decoded module_info: the import and export records Bun
+// computes for an ES module compiled to bytecode, so that JSC can link the
+// module without parsing its source.
+type ModuleInfo struct {
+	ContainsImportMeta bool              `json:"contains_import_meta"`
+	IsTypeScript       bool              `json:"is_typescript"`
+	RequestedModules   []RequestedModule `json:"requested_modules"`
+	Imports            []ModuleImport    `json:"imports"`
+	Exports            []ModuleExport    `json:"exports"`
+	StarExports        []string          `json:"star_exports"` // export * from these
+	DeclaredVariables  []string          `json:"declared_variables,omitempty"`
+	LexicalVariables   []string          `json:"lexical_variables,omitempty"`
+}
+
+// RequestedModule is a module specifier the module imports from, with the
+// type of its import attributes, e.g. "json", if any.
+type RequestedModule struct {
+	Specifier string `json:"specifier"`
+	Type      string `json:"type,omitempty"`
+}
+
+// ModuleImport binds Local to the export Name of Module. Name is "*" for a
+// namespace import. TypeScript marks an import from a TypeScript module that
+// may only name a type, which JSC does not require to exist.
+type ModuleImport struct {
+	Module     string `json:"module"`
+	Name       string `json:"name"`
+	Local      string `json:"local"`
+	TypeScript bool   `json:"typescript,omitempty"`
+}
+
+// ModuleExport exports Name: the local binding Local, or the export Import
+// of Module, where Import "*" re-exports Module's namespace. Local is
+// "*default*" for an anonymous default export.
+type ModuleExport struct {
+	Name   string `json:"name"`
+	Local  string `json:"local,omitempty"`
+	Module string `json:"module,omitempty"`
+	Import string `json:"import,omitempty"`
+}
+
+// Record kinds of a serialized module_info, and the number of string IDs
+// each takes.
+const (
+	recordDeclaredVariable = iota
+	recordLexicalVariable
+	recordImportSingle
+	recordImportSingleTypeScript
+	recordImportNamespace
+	recordExportIndirect
+	recordExportLocal
+	recordExportNamespace
+	recordExportStar
+)
+
+var recordLen = [...]int{1, 1, 3, 3, 3, 3, 3, 2, 1}
+
+// Special string IDs.
+const (
+	starDefault   = 0xffffffff
+	starNamespace = 0xfffffffe
+)
+
+// Special values of a requested module's fetch parameters; any other value
+// is the string ID of a host-defined type.
+var fetchTypes = map[uint32]string{
+	0xffffffff: "",
+	0xfffffffe: "javascript",
+	0xfffffffd: "webassembly",
+	0xfffffffc: "json",
+}
+
+// DecodeModuleInfo decodes a module_info as Bun serializes it: the record
+// kinds, the string IDs the records refer to, the requested modules, flags,
+// and the strings. Integers are little-endian. Data that is truncated, has
+// bytes left over or refers to strings it does not hold is rejected.
+func DecodeModuleInfo(data []byte) (*ModuleInfo, error) {
+	r := moduleInfoReader{data: data}
+	kinds := r.bytes(int(r.u32()))
+	r.bytes((4 - len(kinds)%4) % 4)
+	buffer := r.u32s(int(r.u32()))
+	nreq := int(r.u32())
+	reqKeys := r.u32s(nreq)
+	reqValues := r.u32s(nreq)
+	flags := r.bytes(4)
+	lens := r.u32s(int(r.u32()))
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedModuleInfo, r.err)
+	}
+
+	var strs []string
+	buf := data[r.off:]
+	for _, n := range lens {
+		if uint64(n) > uint64(len(buf)) {
+			return nil, fmt.Errorf("%w: string of %d bytes overruns the %d left", ErrMalformedModuleInfo, n, len(buf))
+		}
+		strs = append(strs, string(buf[:n]))
+		buf = buf[n:]
+	}
+	if len(buf) > 0 {
+		return nil, fmt.Errorf("%w: %d bytes left after the strings", ErrMalformedModuleInfo, len(buf))
+	}
+	str := func(id uint32) (string, error) {
+		switch {
+		case id == starDefault:
+			return "*default*", nil
+		case id == starNamespace:
+			return "*", nil
+		case int64(id) >= int64(len(strs)):
+			return "", fmt.Errorf("%w: string ID %d out of range [0, %d)", ErrMalformedModuleInfo, id, len(strs))
+		}
+		return strs[id], nil
+	}
+
+	info := &ModuleInfo{
+		ContainsImportMeta: flags[0]&1 != 0,
+		IsTypeScript:       flags[0]&2 != 0,
+		RequestedModules:   make([]RequestedModule, 0, nreq),
+		Imports:            []ModuleImport{},
+		Exports:            []ModuleExport{},
+		StarExports:        []string{},
+	}
+	for i := range reqKeys {
+		rm := RequestedModule{}
+		var err error
+		if rm.Specifier, err = str(reqKeys[i]); err != nil {
+			return nil, err
+		}
+		if t, ok := fetchTypes[reqValues[i]]; ok {
+			rm.Type = t
+		} else if rm.Type, err = str(reqValues[i]); err != nil {
+			return nil, err
+		}
+		info.RequestedModules = append(info.RequestedModules, rm)
+	}
+
+	for i, kind := range kinds {
+		if int(kind) >= len(recordLen) {
+			return nil, fmt.Errorf("%w: record %d has unknown kind %d", ErrMalformedModuleInfo, i, kind)
+		}
+		n := recordLen[kind]
+		if n > len(buffer) {
+			return nil, fmt.Errorf("%w: record %d overruns the string IDs", ErrMalformedModuleInfo, i)
+		}
+		s := make([]string, n)
+		for k, id := range buffer[:n] {
+			if kind == recordExportLocal && k == 2 {
+				break // padding
+			}
+			var err error
+			if s[k], err = str(id); err != nil {
+				return nil, err
+			}
+		}
+		buffer = buffer[n:]
+
+		switch kind {
+		case recordDeclaredVariable:
+			info.DeclaredVariables = append(info.DeclaredVariables, s[0])
+		case recordLexicalVariable:
+			info.LexicalVariables = append(info.LexicalVariables, s[0])
+		case recordImportSingle, recordImportSingleTypeScript, recordImportNamespace:
+			info.Imports = append(info.Imports, ModuleImport{Module: s[0], Name: s[1], Local: s[2], TypeScript: kind == recordImportSingleTypeScript})
+		case recordExportIndirect:
+			info.Exports = append(info.Exports, ModuleExport{Name: s[0], Import: s[1], Module: s[2]})
+		case recordExportLocal:
+			info.Exports = append(info.Exports, ModuleExport{Name: s[0], Local: s[1]})
+		case recordExportNamespace:
+			info.Exports = append(info.Exports, ModuleExport{Name: s[0], Module: s[1], Import: "*"})
+		case recordExportStar:
+			info.StarExports = append(info.StarExports, s[0])
+		}
+	}
+	if len(buffer) > 0 {
+		return nil, fmt.Errorf("%w: %d string IDs left after the records", ErrMalformedModuleInfo, len(buffer))
+	}
+	return info, nil
+}
+
+// ModuleInfo decodes the module_info of m, or returns nil if it has none.
+func (exe *ExecutableData) ModuleInfo(m ModuleStruct) (*ModuleInfo, error) {
+	if m.ModuleInfo.Length == 0 {
+		return nil, nil
+	}
+	data, err := exe.ReadPointer(m.ModuleInfo)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedModuleInfo, err)
+	}
+	return DecodeModuleInfo(data)
+}
+
+type moduleInfoReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *moduleInfoReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.off {
+		r.err = errors.New("truncated")
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *moduleInfoReader) u32() uint32 {
+	b := r.bytes(4)
+	if r.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *moduleInfoReader) u32s(n int) []uint32 {
+	if r.err == nil && n > (len(r.data)-r.off)/4 {
+		r.err = errors.New("truncated")
+	}
+	if r.err != nil {
+		return nil
+	}
+	out := make([]uint32, n)
+	for i := range out {
+		out[i] = r.u32()
+	}
+	return out
+}
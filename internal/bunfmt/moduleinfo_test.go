@@ -0,0 +1,107 @@
+package bunfmt
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// encodeModuleInfo serializes a module_info the way Bun does.
+func encodeModuleInfo(kinds []byte, ids []uint32, reqKeys, reqValues []uint32, flags byte, strs []string) []byte {
+	le := func(b []byte, vs ...uint32) []byte {
+		for _, v := range vs {
+			b = binary.LittleEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	b := le(nil, uint32(len(kinds)))
+	b = append(b, kinds...)
+	b = append(b, make([]byte, (4-len(kinds)%4)%4)...)
+	b = le(b, uint32(len(ids)))
+	b = le(b, ids...)
+	b = le(b, uint32(len(reqKeys)))
+	b = le(b, reqKeys...)
+	b = le(b, reqValues...)
+	b = append(b, flags, 0, 0, 0)
+	b = le(b, uint32(len(strs)))
+	for _, s := range strs {
+		b = le(b, uint32(len(s)))
+	}
+	for _, s := range strs {
+		b = append(b, s...)
+	}
+	return b
+}
+
+func testModuleInfo() []byte {
+	strs := []string{"./b.js", "a", "x", "./c.js", "ns", "foo", "./d.js", "bar", "./e.js", "data.json", "json", "v"}
+	kinds := []byte{
+		recordImportSingle, recordImportSingleTypeScript, recordImportNamespace, recordExportIndirect,
+		recordExportLocal, recordExportNamespace, recordExportStar, recordDeclaredVariable,
+	}
+	ids := []uint32{
+		0, 1, 1, // import { a } from "./b.js"
+		0, 1, 2, // import { a as x } from "./b.js"
+		3, starNamespace, 4, // import * as ns from "./c.js"
+		5, 1, 6, // export { a as foo } from "./d.js"
+		7, starDefault, 0, // export { *default* as bar }
+		4, 3, // export * as ns from "./c.js"
+		8,  // export * from "./e.js"
+		11, // var v
+	}
+	return encodeModuleInfo(kinds, ids, []uint32{0, 9}, []uint32{0xffffffff, 10}, 3, strs)
+}
+
+func TestDecodeModuleInfo(t *testing.T) {
+	got, err := DecodeModuleInfo(testModuleInfo())
+	if err != nil {
+		t.Fatalf("DecodeModuleInfo: %v", err)
+	}
+	want := &ModuleInfo{
+		ContainsImportMeta: true,
+		IsTypeScript:       true,
+		RequestedModules:   []RequestedModule{{Specifier: "./b.js"}, {Specifier: "data.json", Type: "json"}},
+		Imports: []ModuleImport{
+			{Module: "./b.js", Name: "a", Local: "a"},
+			{Module: "./b.js", Name: "a", Local: "x", TypeScript: true},
+			{Module: "./c.js", Name: "*", Local: "ns"},
+		},
+		Exports: []ModuleExport{
+			{Name: "foo", Import: "a", Module: "./d.js"},
+			{Name: "bar", Local: "*default*"},
+			{Name: "ns", Module: "./c.js", Import: "*"},
+		},
+		StarExports:       []string{"./e.js"},
+		DeclaredVariables: []string{"v"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeModuleInfo =\n  %+v\nwant\n  %+v", got, want)
+	}
+}
+
+func TestDecodeModuleInfoMalformed(t *testing.T) {
+	valid := testModuleInfo()
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"trailing byte", append(append([]byte(nil), valid...), 'x')},
+		{"unknown record kind", encodeModuleInfo([]byte{42}, []uint32{0}, nil, nil, 0, []string{"a"})},
+		{"record overruns IDs", encodeModuleInfo([]byte{recordImportSingle}, []uint32{0}, nil, nil, 0, []string{"a"})},
+		{"IDs left over", encodeModuleInfo([]byte{recordExportStar}, []uint32{0, 0}, nil, nil, 0, []string{"a"})},
+		{"string ID out of range", encodeModuleInfo([]byte{recordExportStar}, []uint32{1}, nil, nil, 0, []string{"a"})},
+	}
+	for n := 0; n < len(valid); n++ {
+		tests = append(tests, struct {
+			name string
+			data []byte
+		}{"truncated", valid[:n]})
+	}
+	for _, tt := range tests {
+		info, err := DecodeModuleInfo(tt.data)
+		if !errors.Is(err, ErrMalformedModuleInfo) {
+			t.Errorf("%s (%d bytes): DecodeModuleInfo = %+v, %v; want ErrMalformedModuleInfo", tt.name, len(tt.data), info, err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package bunfmt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ExtractManifestName is the file ExtractBunExe writes into the output
+// directory to describe what it extracted.
+const ExtractManifestName = "manifest.json"
+
+// ExtractManifestVersion is the version of the manifest format.
+const ExtractManifestVersion = 1
+
+// ExtractManifest records what resolveOutputPath loses — original names,
+// indices and module entries — so that an extracted directory can be packed
+// back into a module graph. It holds no timestamps or absolute paths, so
+// extracting the same executable twice gives the same manifest.
+type ExtractManifest struct {
+	Version         int               `json:"version"`
+	SourceSHA256    string            `json:"source_sha256"`
+	Layout          string            `json:"layout"`
+	BunVersion      string            `json:"bun_version,omitempty"`
+	EntryPointID    uint32            `json:"entry_point_id"`
+	CompileExecArgv string            `json:"compile_exec_argv"`
+	Flags           uint32            `json:"flags"`
+	Modules         []ExtractedModule `json:"modules"`
+}
+
+// ExtractedModule describes one module of an extraction. Paths are relative
+// to the output directory and slash-separated; File is empty for a module
+// without contents or one left out by a filter, which is marked Skipped.
+// SHA256 and BeautifiedSHA256 are the hashes of File and Beautified as
+// extracted, so that edits to them can be detected. Sources lists the
+// original files recovered from the module's source map, which pack ignores,
+// as it does ModuleInfoRecords, the decoded module info.
+type ExtractedModule struct {
+	Index              int         `json:"index"`
+	Name               string      `json:"name"`
+	Skipped            bool        `json:"skipped,omitempty"`
+	File               string      `json:"file,omitempty"`
+	SHA256             string      `json:"sha256"`
+	Loader             string      `json:"loader"`
+	Encoding           string      `json:"encoding"`
+	ModuleFormat       string      `json:"module_format"`
+	Side               string      `json:"side"`
+	SourceMap          string      `json:"sourcemap,omitempty"`
+	Bytecode           string      `json:"bytecode,omitempty"`
+	ModuleInfo         string      `json:"module_info,omitempty"`
+	ModuleInfoRecords  *ModuleInfo `json:"module_info_records,omitempty"`
+	BytecodeOriginPath string      `json:"bytecode_origin_path,omitempty"`
+	Beautified         string      `json:"beautified,omitempty"`
+	BeautifiedSHA256   string      `json:"beautified_sha256,omitempty"`
+	Sources            []string    `json:"sources,omitempty"`
+
+	// Struct is the module's entry as stored in the executable.
+	Struct ExtractedStruct `json:"struct"`
+}
+
+// ExtractedStruct mirrors ModuleStruct with pointers relative to the blob.
+type ExtractedStruct struct {
+	Name               StringPointer `json:"name"`
+	Contents           StringPointer `json:"contents"`
+	SourceMap          StringPointer `json:"sourcemap"`
+	Bytecode           StringPointer `json:"bytecode"`
+	ModuleInfo         StringPointer `json:"module_info"`
+	BytecodeOriginPath StringPointer `json:"bytecode_origin_path"`
+	Encoding           uint8         `json:"encoding"`
+	Loader             uint8         `json:"loader"`
+	ModuleFormat       uint8         `json:"module_format"`
+	Side               uint8         `json:"side"`
+}
+
+func extractedStruct(m ModuleStruct) ExtractedStruct {
+	return ExtractedStruct{
+		Name:               m.Name,
+		Contents:           m.Contents,
+		SourceMap:          m.SourceMap,
+		Bytecode:           m.Bytecode,
+		ModuleInfo:         m.ModuleInfo,
+		BytecodeOriginPath: m.BytecodeOriginPath,
+		Encoding:           m.Encoding,
+		Loader:             m.Loader,
+		ModuleFormat:       m.ModuleFormat,
+		Side:               m.Side,
+	}
+}
+
+// ReadExtractManifest loads the manifest of the extraction in dir.
+func ReadExtractManifest(dir string) (*ExtractManifest, error) {
+	path := filepath.Join(dir, ExtractManifestName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m ExtractManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if m.Version > ExtractManifestVersion {
+		return nil, fmt.Errorf("reading %s: manifest version %d is newer than this claudeload supports (%d)", path, m.Version, ExtractManifestVersion)
+	}
+	return &m, nil
+}
+
+// LoadExtracted rebuilds the module graph extracted into dir. A module's
+// beautified copy is used instead of its file when it has been edited, so
+// that it can be edited in place; editing both is an error. Skipped modules
+// are copied from base by name. The graph's Layout is the one the manifest
+// names, or nil if it names none we know.
+func LoadExtracted(dir string, base *Graph) (*Graph, error) {
+	m, err := ReadExtractManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{
+		Files:           make([]GraphFile, len(m.Modules)),
+		EntryPointID:    m.EntryPointID,
+		CompileExecArgv: []byte(m.CompileExecArgv),
+		Flags:           m.Flags,
+	}
+	for _, l := range Layouts {
+		if l.Name == m.Layout {
+			g.Layout = l
+		}
+	}
+	seen := make([]bool, len(m.Modules))
+	for _, em := range m.Modules {
+		if em.Index < 0 || em.Index >= len(m.Modules) || seen[em.Index] {
+			return nil, fmt.Errorf("module %q: bad or duplicate index %d", em.Name, em.Index)
+		}
+		seen[em.Index] = true
+
+		if em.Skipped {
+			i := -1
+			if base != nil {
+				i = base.FileIndex(em.Name)
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("module %q was not extracted and is not in the base executable", em.Name)
+			}
+			g.Files[em.Index] = base.Files[i]
+			continue
+		}
+
+		f := GraphFile{Name: em.Name, BytecodeOriginPath: []byte(em.BytecodeOriginPath)}
+		for _, field := range []struct {
+			dst   *uint8
+			names map[uint8]string
+			value string
+			what  string
+		}{
+			{&f.Loader, LoaderName, em.Loader, "loader"},
+			{&f.Encoding, EncodingName, em.Encoding, "encoding"},
+			{&f.ModuleFormat, ModuleFormatName, em.ModuleFormat, "module format"},
+			{&f.Side, SideName, em.Side, "side"},
+		} {
+			v, ok := enumValue(field.names, field.value)
+			if !ok {
+				return nil, fmt.Errorf("module %q: unknown %s %q", em.Name, field.what, field.value)
+			}
+			*field.dst = v
+		}
+
+		for _, side := range []struct {
+			dst  *[]byte
+			path string
+		}{
+			{&f.Contents, em.File},
+			{&f.SourceMap, em.SourceMap},
+			{&f.Bytecode, em.Bytecode},
+			{&f.ModuleInfo, em.ModuleInfo},
+		} {
+			if side.path == "" {
+				continue
+			}
+			p, err := extractedPath(dir, side.path)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: %w", em.Name, err)
+			}
+			if *side.dst, err = os.ReadFile(p); err != nil {
+				return nil, fmt.Errorf("module %q: %w", em.Name, err)
+			}
+		}
+		if em.Beautified != "" && em.BeautifiedSHA256 != "" {
+			p, err := extractedPath(dir, em.Beautified)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: %w", em.Name, err)
+			}
+			b, err := os.ReadFile(p)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("module %q: %w", em.Name, err)
+			}
+			if err == nil && sha256Hex(b) != em.BeautifiedSHA256 {
+				if em.SHA256 != "" && sha256Hex(f.Contents) != em.SHA256 {
+					return nil, fmt.Errorf("module %q: both %s and %s were edited", em.Name, em.File, em.Beautified)
+				}
+				f.Contents = b
+			}
+		}
+		g.Files[em.Index] = f
+	}
+	return g, nil
+}
+
+// extractedPath resolves the manifest path rel against dir. The manifest may
+// have been edited, so a path leading outside dir is refused rather than
+// read into the graph.
+func extractedPath(dir, rel string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	r, err := filepath.Rel(dir, p)
+	if err != nil || filepath.IsAbs(rel) || filepath.IsAbs(r) || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("manifest path %q lies outside %s", rel, dir)
+	}
+	return p, nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// enumValue is the inverse of enumName.
+func enumValue(names map[uint8]string, s string) (uint8, bool) {
+	for v, n := range names {
+		if n == s {
+			return v, true
+		}
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	return uint8(v), err == nil
+}
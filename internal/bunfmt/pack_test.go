@@ -0,0 +1,113 @@
+package bunfmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractedPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	tests := []struct {
+		rel string
+		ok  bool
+	}{
+		{"root/cli.js.js", true},
+		{"root/../manifest.json", true},
+		{"../secret", false},
+		{"root/../../secret", false},
+		{"..", false},
+		{"/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		p, err := extractedPath(dir, tt.rel)
+		if (err == nil) != tt.ok {
+			t.Errorf("extractedPath(%q) = %q, %v; want ok=%t", tt.rel, p, err, tt.ok)
+		}
+	}
+}
+
+func TestLoadExtractedRefusesEscapingPaths(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "out")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"version":1,"layout":"v1.3","modules":[{"index":0,"name":"/$bunfs/root/a.js","file":"../secret",` +
+		`"loader":"js","encoding":"utf8","module_format":"esm","side":"server"}]}`
+	if err := os.WriteFile(filepath.Join(dir, ExtractManifestName), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if g, err := LoadExtracted(dir, nil); err == nil {
+		t.Errorf("LoadExtracted read %q from outside the directory", g.Files[0].Contents)
+	}
+}
+
+func TestExtractManifestRoundTrip(t *testing.T) {
+	want := testGraph()
+	want.Files[1].ModuleInfo = testModuleInfo()
+	dir := t.TempDir()
+	exePath := filepath.Join(dir, "claude")
+	data := buildExe(t, "runtime Bun v1.3.2", want)
+	if err := os.WriteFile(exePath, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := ExtractBunExe(exePath, ExtractOptions{OutputDir: out, Jobs: 1}); err != nil {
+		t.Fatalf("ExtractBunExe: %v", err)
+	}
+
+	m, err := ReadExtractManifest(out)
+	if err != nil {
+		t.Fatalf("ReadExtractManifest: %v", err)
+	}
+	if m.Layout != LatestLayout.Name || m.BunVersion != "1.3.2" || m.EntryPointID != want.EntryPointID ||
+		m.CompileExecArgv != string(want.CompileExecArgv) || m.Flags != want.Flags || m.SourceSHA256 != sha256Hex(data) {
+		t.Errorf("manifest header = %+v", m)
+	}
+	if len(m.Modules) != len(want.Files) {
+		t.Fatalf("manifest lists %d modules, want %d", len(m.Modules), len(want.Files))
+	}
+	for i, em := range m.Modules {
+		f := want.Files[i]
+		if em.Index != i || em.Name != f.Name || em.Struct.Loader != f.Loader || em.Struct.Encoding != f.Encoding {
+			t.Errorf("module %d = %+v, want %s", i, em, f.Name)
+		}
+		if em.File == "" {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(em.File)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, f.Contents) || em.SHA256 != sha256Hex(contents) {
+			t.Errorf("module %d: %s holds %q with sha256 %s", i, em.File, contents, em.SHA256)
+		}
+	}
+
+	// Extracting twice gives the same manifest.
+	again := filepath.Join(dir, "again")
+	if err := ExtractBunExe(exePath, ExtractOptions{OutputDir: again, Jobs: 4}); err != nil {
+		t.Fatalf("ExtractBunExe: %v", err)
+	}
+	m2, err := ReadExtractManifest(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j1, _ := json.Marshal(m)
+	j2, _ := json.Marshal(m2)
+	if !bytes.Equal(j1, j2) {
+		t.Errorf("second extraction wrote a different manifest:\n%s\n%s", j1, j2)
+	}
+
+	got, err := LoadExtracted(out, nil)
+	if err != nil {
+		t.Fatalf("LoadExtracted: %v", err)
+	}
+	assertSameGraph(t, got, want)
+}
@@ -9,12 +9,15 @@ import (
 )
 
 type ExecutableData struct {
-	Blob         []byte
+	Src          Source
 	ModulesBytes []byte
 	BlobStart    int64
 	TrailerPos   int64
 	Offsets      OffsetsStruct
 	NumModules   int
+	Section      *Section // nil when the graph is appended to the file
+	Layout       *Layout
+	BunVersion   Version // zero when no version string was found
 }
 
 func FindBunTrailer(path string) (int64, error) {
@@ -28,22 +31,24 @@ func FindBunTrailer(path string) (int64, error) {
 	if err != nil {
 		return -1, err
 	}
-	fileSize := fi.Size()
+	return findTrailerInRange(f, 0, fi.Size())
+}
+
+// findTrailerInRange scans backwards from end for the last Trailer that lies
+// entirely within [start, end).
+func findTrailerInRange(r io.ReaderAt, start, end int64) (int64, error) {
 	trailerLen := int64(len(Trailer))
 
-	pos := fileSize
-	for pos > 0 {
+	pos := end
+	for pos > start {
 		readLen := int64(ChunkSize)
-		if readLen > pos {
-			readLen = pos
+		if readLen > pos-start {
+			readLen = pos - start
 		}
 		pos -= readLen
 
-		if _, err := f.Seek(pos, io.SeekStart); err != nil {
-			return -1, err
-		}
 		chunk := make([]byte, readLen)
-		if _, err := io.ReadFull(f, chunk); err != nil {
+		if _, err := r.ReadAt(chunk, pos); err != nil {
 			return -1, err
 		}
 
@@ -51,7 +56,7 @@ func FindBunTrailer(path string) (int64, error) {
 			return pos + int64(idx), nil
 		}
 
-		if pos < trailerLen {
+		if pos-start < trailerLen {
 			break
 		}
 		pos += trailerLen
@@ -60,43 +65,94 @@ func FindBunTrailer(path string) (int64, error) {
 	return -1, nil
 }
 
+// LoadExecutable opens path and parses its module graph. The returned
+// ExecutableData keeps the file open (memory-mapped where supported) and
+// must be closed by the caller.
 func LoadExecutable(path string, verbose bool) (*ExecutableData, error) {
+	if verbose {
+		fmt.Printf("[*] Analyzing %s...\n", path)
+	}
+	src, err := OpenSource(path)
+	if err != nil {
+		return nil, err
+	}
+	exe, err := Load(src, verbose)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return exe, nil
+}
+
+// Load parses the module graph of the executable readable through src.
+// Only the offsets struct and module table are read eagerly; module data is
+// read on demand through ReadPointer.
+func Load(src Source, verbose bool) (*ExecutableData, error) {
 	logv := func(format string, args ...any) {
 		if verbose {
 			fmt.Printf(format, args...)
 		}
 	}
 
-	logv("[*] Analyzing %s...\n", path)
+	fileSize := src.Size()
+	section, err := FindBunSection(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing executable headers: %w", err)
+	}
+
+	// Without a dedicated section the graph is appended to the file, so the
+	// whole file is fair game for the trailer scan.
+	scanStart, scanEnd := int64(0), fileSize
+	if section != nil {
+		logv("[*] Found %s section %s at offset %d (%d bytes)\n", section.Format, section.Name, section.Offset, section.Size)
+		scanStart, scanEnd = section.Offset, section.End()
+		if scanEnd > fileSize {
+			return nil, fmt.Errorf("%s section %s extends past end of file (%d > %d)", section.Format, section.Name, scanEnd, fileSize)
+		}
+	}
 
-	trailerPos, err := FindBunTrailer(path)
+	trailerPos, err := findTrailerInRange(src, scanStart, scanEnd)
 	if err != nil {
 		return nil, fmt.Errorf("scanning for trailer: %w", err)
 	}
+	if trailerPos < 0 && section != nil {
+		logv("[*] No trailer inside %s — falling back to a full file scan\n", section.Name)
+		section = nil
+		scanStart = 0
+		trailerPos, err = findTrailerInRange(src, scanStart, fileSize)
+		if err != nil {
+			return nil, fmt.Errorf("scanning for trailer: %w", err)
+		}
+	}
 	if trailerPos < 0 {
 		return nil, fmt.Errorf("could not find Bun trailer signature — is this a 'bun build --compile' executable?")
 	}
 	logv("[*] Found trailer at offset: %d\n", trailerPos)
 
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+	// The version string belongs to the runtime image, which ends where the
+	// graph begins. Searching past that point would let any bundled module
+	// that mentions "Bun vX.Y.Z" pick the layout.
+	runtimeEnd := scanStart
+	if section == nil {
+		runtimeEnd = lowestBlobStart(src, trailerPos)
 	}
-	defer f.Close()
-
-	offsetsStart := trailerPos - int64(OffsetsStructSize)
-	if _, err := f.Seek(offsetsStart, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("seeking to offsets struct: %w", err)
+	version, err := DetectBunVersion(src, runtimeEnd)
+	if err != nil {
+		return nil, fmt.Errorf("scanning for Bun version: %w", err)
 	}
-	offsetsBuf := make([]byte, OffsetsStructSize)
-	if _, err := io.ReadFull(f, offsetsBuf); err != nil {
-		return nil, fmt.Errorf("reading offsets struct: %w", err)
+	if !version.IsZero() {
+		logv("[*] Detected Bun v%s\n", version)
 	}
 
-	offsets, err := ReadOffsetsStruct(offsetsBuf)
+	layout, offsets, err := detectLayout(src, trailerPos, scanStart, version)
 	if err != nil {
 		return nil, err
 	}
+	logv("[*] Using layout %s\n", layout)
+	if !version.IsZero() && layout != LayoutForVersion(version) {
+		logv("[*] Layout does not match the one expected for Bun v%s — chosen from graph contents\n", version)
+	}
+	offsetsStart := trailerPos - int64(layout.OffsetsStructSize())
 
 	logv("\n--- Offsets Struct ---\n")
 	logv("  byte_count:            %d bytes\n", offsets.ByteCount)
@@ -109,54 +165,193 @@ func LoadExecutable(path string, verbose bool) (*ExecutableData, error) {
 	if blobStart < 0 {
 		return nil, fmt.Errorf("calculated blob start is negative — file may be corrupted")
 	}
+	if section != nil && blobStart < section.Offset {
+		return nil, fmt.Errorf("blob start %d lies before %s section start %d — file may be corrupted", blobStart, section.Name, section.Offset)
+	}
 	logv("  blob_start:            %d\n", blobStart)
 
-	if _, err := f.Seek(blobStart, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("seeking to blob: %w", err)
-	}
-	blob := make([]byte, offsets.ByteCount)
-	if _, err := io.ReadFull(f, blob); err != nil {
-		return nil, fmt.Errorf("unexpected EOF reading data blob: %w", err)
+	modulesBytes := make([]byte, offsets.ModulesPtr.Length)
+	if _, err := src.ReadAt(modulesBytes, blobStart+int64(offsets.ModulesPtr.Offset)); err != nil {
+		return nil, fmt.Errorf("reading module table: %w", err)
 	}
-
-	modulesBytes := offsets.ModulesPtr.Read(blob)
-	numModules := len(modulesBytes) / ModuleStructSize
+	numModules := len(modulesBytes) / layout.ModuleStructSize()
 	logv("  module_count:          %d\n", numModules)
 
-	argvData := offsets.CompileExecArgvPtr.Read(blob)
-	if len(argvData) > 0 {
-		logv("  compile_exec_argv:     %s\n", strings.ToValidUTF8(string(argvData), "?"))
-	}
-
-	return &ExecutableData{
-		Blob:         blob,
+	exe := &ExecutableData{
+		Src:          src,
 		ModulesBytes: modulesBytes,
 		BlobStart:    blobStart,
 		TrailerPos:   trailerPos,
 		Offsets:      offsets,
 		NumModules:   numModules,
-	}, nil
+		Section:      section,
+		Layout:       layout,
+		BunVersion:   version,
+	}
+
+	if argvData, err := exe.ReadPointer(offsets.CompileExecArgvPtr); err == nil && len(argvData) > 0 {
+		logv("  compile_exec_argv:     %s\n", strings.ToValidUTF8(string(argvData), "?"))
+	}
+	return exe, nil
+}
+
+// detectLayout reads the offsets struct preceding the trailer in each known
+// layout and returns the first one describing a plausible graph. The layout
+// matching version is tried first when the version is known.
+func detectLayout(r io.ReaderAt, trailerPos, regionStart int64, version Version) (*Layout, OffsetsStruct, error) {
+	candidates := Layouts
+	if !version.IsZero() {
+		preferred := LayoutForVersion(version)
+		candidates = []*Layout{preferred}
+		for _, l := range Layouts {
+			if l != preferred {
+				candidates = append(candidates, l)
+			}
+		}
+	}
+
+	var reasons []string
+	for _, l := range candidates {
+		offsets, err := probeLayout(r, l, trailerPos, regionStart)
+		if err == nil {
+			return l, offsets, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %v", l.Name, err))
+	}
+	return nil, OffsetsStruct{}, fmt.Errorf("no known graph layout matches this executable (%s)", strings.Join(reasons, "; "))
+}
+
+// lowestBlobStart returns the earliest blob start of any layout that
+// describes a plausible graph before trailerPos, or trailerPos when none
+// does. Everything before it belongs to the runtime image whichever layout
+// turns out to be the right one.
+func lowestBlobStart(r io.ReaderAt, trailerPos int64) int64 {
+	lowest := trailerPos
+	for _, l := range Layouts {
+		offsets, err := probeLayout(r, l, trailerPos, 0)
+		if err != nil {
+			continue
+		}
+		if start := trailerPos - int64(l.OffsetsStructSize()) - int64(offsets.ByteCount); start < lowest {
+			lowest = start
+		}
+	}
+	return lowest
+}
+
+// probeLayout checks whether the bytes before the trailer make sense when
+// read as layout l: the blob must fit in the region, the module table must
+// divide evenly into entries, and most entries must point inside the blob
+// with a known encoding and loader. A few bad entries are tolerated so that
+// Validate can report them instead of the graph failing to load at all.
+func probeLayout(r io.ReaderAt, l *Layout, trailerPos, regionStart int64) (OffsetsStruct, error) {
+	offsetsStart := trailerPos - int64(l.OffsetsStructSize())
+	if offsetsStart < regionStart {
+		return OffsetsStruct{}, fmt.Errorf("offsets struct would start before the graph region")
+	}
+	buf := make([]byte, l.OffsetsStructSize())
+	if _, err := r.ReadAt(buf, offsetsStart); err != nil {
+		return OffsetsStruct{}, fmt.Errorf("reading offsets struct: %w", err)
+	}
+	offsets, err := l.ReadOffsetsStruct(buf)
+	if err != nil {
+		return OffsetsStruct{}, err
+	}
+
+	byteCount := offsets.ByteCount
+	if byteCount > uint64(offsetsStart-regionStart) {
+		return OffsetsStruct{}, fmt.Errorf("byte_count %d exceeds the space before the offsets struct", byteCount)
+	}
+	modEnd := uint64(offsets.ModulesPtr.Offset) + uint64(offsets.ModulesPtr.Length)
+	if offsets.ModulesPtr.Length == 0 || modEnd > byteCount {
+		return OffsetsStruct{}, fmt.Errorf("modules_ptr does not lie within the blob")
+	}
+	size := l.ModuleStructSize()
+	if int(offsets.ModulesPtr.Length)%size != 0 {
+		return OffsetsStruct{}, fmt.Errorf("modules length %d is not a multiple of %d", offsets.ModulesPtr.Length, size)
+	}
+	count := int(offsets.ModulesPtr.Length) / size
+
+	table := make([]byte, offsets.ModulesPtr.Length)
+	blobStart := offsetsStart - int64(byteCount)
+	if _, err := r.ReadAt(table, blobStart+int64(offsets.ModulesPtr.Offset)); err != nil {
+		return OffsetsStruct{}, fmt.Errorf("reading module table: %w", err)
+	}
+	bad := 0
+	for i := 0; i < count; i++ {
+		m, err := l.ReadModuleStruct(table[i*size:])
+		if err != nil {
+			return OffsetsStruct{}, err
+		}
+		if !plausibleModule(m, byteCount) {
+			bad++
+		}
+	}
+	if bad*2 > count {
+		return OffsetsStruct{}, fmt.Errorf("%d of %d module entries are not plausible", bad, count)
+	}
+	return offsets, nil
+}
+
+// plausibleModule reports whether every pointer of m lies within a blob of
+// byteCount bytes and its encoding and loader are known values.
+func plausibleModule(m ModuleStruct, byteCount uint64) bool {
+	for _, sp := range m.pointers() {
+		if uint64(sp.Offset)+uint64(sp.Length) > byteCount {
+			return false
+		}
+	}
+	_, encOK := EncodingName[m.Encoding]
+	_, loaderOK := LoaderExtension[m.Loader]
+	return encOK && loaderOK
 }
 
 func (exe *ExecutableData) GetModule(index int) (ModuleStruct, error) {
 	if index < 0 || index >= exe.NumModules {
 		return ModuleStruct{}, fmt.Errorf("module index %d out of range [0, %d)", index, exe.NumModules)
 	}
-	start := index * ModuleStructSize
-	end := start + ModuleStructSize
+	size := exe.Layout.ModuleStructSize()
+	start := index * size
+	end := start + size
 	if end > len(exe.ModulesBytes) {
 		return ModuleStruct{}, fmt.Errorf("module index %d is out of bounds in modules data (corrupt binary?)", index)
 	}
-	return ReadModuleStruct(exe.ModulesBytes[start:end])
+	return exe.Layout.ReadModuleStruct(exe.ModulesBytes[start:end])
+}
+
+// Close releases the Source the executable was loaded from.
+func (exe *ExecutableData) Close() error {
+	return exe.Src.Close()
+}
+
+// ReadPointer returns the blob bytes sp refers to. For memory-mapped
+// sources the result aliases the mapping and must not be modified.
+func (exe *ExecutableData) ReadPointer(sp StringPointer) ([]byte, error) {
+	if sp.Length == 0 {
+		return []byte{}, nil
+	}
+	if uint64(sp.Offset)+uint64(sp.Length) > exe.Offsets.ByteCount {
+		return nil, fmt.Errorf("pointer offset=%d length=%d exceeds the %d-byte blob", sp.Offset, sp.Length, exe.Offsets.ByteCount)
+	}
+	start := exe.BlobStart + int64(sp.Offset)
+	if bs, ok := exe.Src.(*bytesSource); ok {
+		return bs.data[start : start+int64(sp.Length) : start+int64(sp.Length)], nil
+	}
+	buf := make([]byte, sp.Length)
+	if _, err := exe.Src.ReadAt(buf, start); err != nil {
+		return nil, fmt.Errorf("reading blob at %d: %w", start, err)
+	}
+	return buf, nil
 }
 
 func (exe *ExecutableData) GetModuleName(m ModuleStruct) string {
-	raw := m.Name.Read(exe.Blob)
+	raw, _ := exe.ReadPointer(m.Name)
 	return strings.ToValidUTF8(string(raw), "?")
 }
 
 func (exe *ExecutableData) GetModuleContent(m ModuleStruct) []byte {
-	return m.Contents.Read(exe.Blob)
+	raw, _ := exe.ReadPointer(m.Contents)
+	return raw
 }
 
 func (exe *ExecutableData) FindModuleByName(name string) (ModuleStruct, int, error) {
@@ -0,0 +1,101 @@
+package bunfmt
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"io"
+	"runtime"
+)
+
+// Section names newer Bun builds use to store the module graph instead of
+// appending it to the end of the executable.
+const (
+	ELFSectionName    = ".bun"
+	PESectionName     = ".bun"
+	MachOSegmentName  = "__BUN"
+	MachOSectionName  = "__bun"
+	sectionSizePrefix = 8 // u64 length Bun writes at the start of the section
+)
+
+// Section describes the container section that holds the module graph.
+type Section struct {
+	Format string `json:"format"` // "elf", "macho" or "pe"
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"` // file offset of the section data
+	Size   int64  `json:"size"`
+}
+
+// End returns the file offset just past the section data.
+func (s *Section) End() int64 {
+	return s.Offset + s.Size
+}
+
+// FindBunSection parses r as an ELF, Mach-O (thin or universal) or PE
+// executable and returns the section holding the Bun module graph. It
+// returns nil without an error when the file is not one of those formats or
+// has no such section, in which case the graph is expected to be appended.
+func FindBunSection(f io.ReaderAt) (*Section, error) {
+	if ef, err := elf.NewFile(f); err == nil {
+		s := ef.Section(ELFSectionName)
+		if s == nil || s.Type == elf.SHT_NOBITS {
+			return nil, nil
+		}
+		return &Section{Format: "elf", Name: ELFSectionName, Offset: int64(s.Offset), Size: int64(s.Size)}, nil
+	}
+
+	if mf, err := macho.NewFile(f); err == nil {
+		return machoSection(mf, 0), nil
+	}
+
+	if ff, err := macho.NewFatFile(f); err == nil {
+		arch := ff.Arches[0]
+		for _, a := range ff.Arches {
+			if machoCPU(a.Cpu) == runtime.GOARCH {
+				arch = a
+				break
+			}
+		}
+		return machoSection(arch.File, int64(arch.Offset)), nil
+	}
+
+	if pf, err := pe.NewFile(f); err == nil {
+		s := pf.Section(PESectionName)
+		if s == nil {
+			return nil, nil
+		}
+		// SizeOfRawData is rounded up to the file alignment; VirtualSize is
+		// the amount Bun actually wrote.
+		size := int64(s.Size)
+		if s.VirtualSize > 0 && int64(s.VirtualSize) < size {
+			size = int64(s.VirtualSize)
+		}
+		return &Section{Format: "pe", Name: PESectionName, Offset: int64(s.Offset), Size: size}, nil
+	}
+
+	return nil, nil
+}
+
+func machoSection(mf *macho.File, base int64) *Section {
+	for _, s := range mf.Sections {
+		if s.Seg == MachOSegmentName && s.Name == MachOSectionName {
+			return &Section{
+				Format: "macho",
+				Name:   MachOSegmentName + "," + MachOSectionName,
+				Offset: base + int64(s.Offset),
+				Size:   int64(s.Size),
+			}
+		}
+	}
+	return nil
+}
+
+func machoCPU(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	}
+	return ""
+}
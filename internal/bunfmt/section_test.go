@@ -0,0 +1,289 @@
+package bunfmt
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// elfImage returns a minimal 64-bit ELF file with a section called name
+// holding data, preceded by pre the way the runtime image precedes it. It
+// returns the image and the file offset of the section data.
+func elfImage(pre, data []byte, name string, typ elf.SectionType) ([]byte, int64) {
+	const headerSize = 64
+	off := int64(headerSize + len(pre))
+	strtab := []byte("\x00.shstrtab\x00" + name + "\x00")
+	strtabOff := off + int64(len(data))
+	shoff := (strtabOff + int64(len(strtab)) + 7) &^ 7
+
+	var b bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(shoff),
+		Ehsize:    headerSize,
+		Shentsize: 64,
+		Shnum:     3,
+		Shstrndx:  1,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.Write(&b, binary.LittleEndian, hdr)
+	b.Write(pre)
+	b.Write(data)
+	b.Write(strtab)
+	b.Write(make([]byte, shoff-int64(b.Len())))
+	for _, sh := range []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: uint64(strtabOff), Size: uint64(len(strtab)), Addralign: 1},
+		{Name: 11, Type: uint32(typ), Flags: uint64(elf.SHF_ALLOC), Off: uint64(off), Size: uint64(len(data)), Addralign: 1},
+	} {
+		binary.Write(&b, binary.LittleEndian, sh)
+	}
+	return b.Bytes(), off
+}
+
+// machoImage returns a minimal 64-bit Mach-O file whose __BUN,__bun section
+// holds data.
+func machoImage(pre, data []byte) ([]byte, int64) {
+	const headerSize, segSize, sectSize = 32, 72, 80
+	off := int64(headerSize + segSize + sectSize + len(pre))
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, macho.FileHeader{
+		Magic: macho.Magic64, Cpu: macho.CpuAmd64, SubCpu: 3, Type: macho.TypeExec,
+		Ncmd: 1, Cmdsz: segSize + sectSize,
+	})
+	b.Write(make([]byte, 4)) // reserved
+	seg := macho.Segment64{
+		Cmd: macho.LoadCmdSegment64, Len: segSize + sectSize,
+		Offset: uint64(off), Filesz: uint64(len(data)), Memsz: uint64(len(data)), Nsect: 1,
+	}
+	copy(seg.Name[:], MachOSegmentName)
+	binary.Write(&b, binary.LittleEndian, seg)
+	sect := macho.Section64{Size: uint64(len(data)), Offset: uint32(off)}
+	copy(sect.Name[:], MachOSectionName)
+	copy(sect.Seg[:], MachOSegmentName)
+	binary.Write(&b, binary.LittleEndian, sect)
+	b.Write(pre)
+	b.Write(data)
+	return b.Bytes(), off
+}
+
+// fatImage wraps a thin amd64 Mach-O file in a universal binary at offset
+// 0x1000.
+func fatImage(thin []byte) []byte {
+	const archOff = 0x1000
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{macho.MagicFat, 1})
+	binary.Write(&b, binary.BigEndian, macho.FatArchHeader{
+		Cpu: macho.CpuAmd64, SubCpu: 3, Offset: archOff, Size: uint32(len(thin)), Align: 12,
+	})
+	b.Write(make([]byte, archOff-b.Len()))
+	b.Write(thin)
+	return b.Bytes()
+}
+
+// peImage returns a minimal PE file whose .bun section holds data, followed
+// by pad bytes of file alignment that SizeOfRawData includes.
+func peImage(pre, data []byte, pad int) ([]byte, int64) {
+	const dosSize, sigSize, fileHdrSize, sectHdrSize = 0x40, 4, 20, 40
+	off := int64(dosSize + sigSize + fileHdrSize + sectHdrSize + len(pre))
+
+	var b bytes.Buffer
+	dos := make([]byte, dosSize)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], dosSize)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	binary.Write(&b, binary.LittleEndian, pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, NumberOfSections: 1})
+	sh := pe.SectionHeader32{
+		VirtualSize:      uint32(len(data)),
+		SizeOfRawData:    uint32(len(data) + pad),
+		PointerToRawData: uint32(off),
+	}
+	copy(sh.Name[:], PESectionName)
+	binary.Write(&b, binary.LittleEndian, sh)
+	b.Write(pre)
+	b.Write(data)
+	b.Write(make([]byte, pad))
+	return b.Bytes(), off
+}
+
+func TestFindBunSection(t *testing.T) {
+	data := []byte("section data")
+	tests := []struct {
+		name  string
+		image func() ([]byte, *Section)
+	}{
+		{"elf", func() ([]byte, *Section) {
+			img, off := elfImage([]byte("runtime"), data, ELFSectionName, elf.SHT_PROGBITS)
+			return img, &Section{Format: "elf", Name: ELFSectionName, Offset: off, Size: int64(len(data))}
+		}},
+		{"elf without .bun", func() ([]byte, *Section) {
+			img, _ := elfImage(nil, data, ".text", elf.SHT_PROGBITS)
+			return img, nil
+		}},
+		{"elf .bun without file data", func() ([]byte, *Section) {
+			img, _ := elfImage(nil, data, ELFSectionName, elf.SHT_NOBITS)
+			return img, nil
+		}},
+		{"macho", func() ([]byte, *Section) {
+			img, off := machoImage([]byte("runtime"), data)
+			return img, &Section{Format: "macho", Name: "__BUN,__bun", Offset: off, Size: int64(len(data))}
+		}},
+		{"universal macho", func() ([]byte, *Section) {
+			thin, off := machoImage(nil, data)
+			return fatImage(thin), &Section{Format: "macho", Name: "__BUN,__bun", Offset: 0x1000 + off, Size: int64(len(data))}
+		}},
+		{"pe", func() ([]byte, *Section) {
+			// VirtualSize, not the padded SizeOfRawData, is what Bun wrote.
+			img, off := peImage([]byte("runtime"), data, 500)
+			return img, &Section{Format: "pe", Name: PESectionName, Offset: off, Size: int64(len(data))}
+		}},
+		{"not an executable", func() ([]byte, *Section) {
+			return []byte("runtime"), nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, want := tt.image()
+			got, err := FindBunSection(bytes.NewReader(img))
+			if err != nil {
+				t.Fatalf("FindBunSection: %v", err)
+			}
+			if (got == nil) != (want == nil) || got != nil && *got != *want {
+				t.Errorf("FindBunSection = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// sectionData returns g stored in a section the way Bun writes it: the u64
+// graph size, the graph and slack zero bytes.
+func sectionData(t *testing.T, g *Graph, slack int) []byte {
+	t.Helper()
+	graph := graphBytes(t, g)
+	out := binary.LittleEndian.AppendUint64(nil, uint64(len(graph)))
+	out = append(out, graph...)
+	return append(out, make([]byte, slack)...)
+}
+
+// sectionImages builds an executable of every container format with data in
+// its Bun section.
+func sectionImages(data []byte) map[string]func() ([]byte, int64) {
+	pre := []byte("runtime Bun v1.3.2")
+	return map[string]func() ([]byte, int64){
+		"elf":   func() ([]byte, int64) { return elfImage(pre, data, ELFSectionName, elf.SHT_PROGBITS) },
+		"macho": func() ([]byte, int64) { return machoImage(pre, data) },
+		"pe":    func() ([]byte, int64) { return peImage(pre, data, 100) },
+	}
+}
+
+func TestLoadFromSection(t *testing.T) {
+	want := testGraph()
+	for format, image := range sectionImages(sectionData(t, want, 64)) {
+		t.Run(format, func(t *testing.T) {
+			img, off := image()
+			exe := loadBytes(t, img)
+			if exe.Section == nil || exe.Section.Format != format {
+				t.Fatalf("section = %+v, want a %s section", exe.Section, format)
+			}
+			if exe.BlobStart != off+sectionSizePrefix {
+				t.Errorf("blob start = %d, want %d (after the size prefix)", exe.BlobStart, off+sectionSizePrefix)
+			}
+			if exe.BunVersion != (Version{1, 3, 2}) {
+				t.Errorf("version = %s, want 1.3.2", exe.BunVersion)
+			}
+			got, err := exe.Graph()
+			if err != nil {
+				t.Fatalf("Graph: %v", err)
+			}
+			assertSameGraph(t, got, want)
+		})
+	}
+}
+
+// A .bun section without a trailer sends Load back to scanning the whole
+// file, which must then accept a graph that lies before the section.
+func TestLoadFallsBackToFullScan(t *testing.T) {
+	want := testGraph()
+	img, _ := elfImage(buildExe(t, "runtime", want), make([]byte, 64), ELFSectionName, elf.SHT_PROGBITS)
+	exe := loadBytes(t, img)
+	if exe.Section != nil {
+		t.Errorf("section = %+v, want none", exe.Section)
+	}
+	got, err := exe.Graph()
+	if err != nil {
+		t.Fatalf("Graph: %v", err)
+	}
+	assertSameGraph(t, got, want)
+}
+
+func TestWriteInSection(t *testing.T) {
+	const slack = 512
+	tests := []struct {
+		name    string
+		edit    func(g *Graph)
+		wantErr string
+	}{
+		{"unchanged", func(g *Graph) {}, ""},
+		{"shrink", func(g *Graph) { g.Files[0].Contents = []byte("0") }, ""},
+		{"grow into the slack", func(g *Graph) { g.Files[0].Contents = bytes.Repeat([]byte("x"), 64) }, ""},
+		{"does not fit", func(g *Graph) { g.Files[0].Contents = bytes.Repeat([]byte("x"), 4*slack) }, "only has room"},
+	}
+	for format, image := range sectionImages(sectionData(t, testGraph(), slack)) {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				img, off := image()
+				exe := loadBytes(t, img)
+				secEnd := exe.Section.End()
+				want, err := exe.Graph()
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.edit(want)
+
+				var buf bytes.Buffer
+				err = exe.WriteExecutable(&buf, want)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("WriteExecutable error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("WriteExecutable: %v", err)
+				}
+				out := buf.Bytes()
+				if len(out) != len(img) {
+					t.Fatalf("rewritten file is %d bytes, want %d: sections cannot grow", len(out), len(img))
+				}
+				if !bytes.Equal(out[:off], img[:off]) || !bytes.Equal(out[secEnd:], img[secEnd:]) {
+					t.Error("bytes outside the section changed")
+				}
+
+				again := loadBytes(t, out)
+				if again.Section == nil || again.Section.Offset != off {
+					t.Fatalf("section = %+v, want one at %d", again.Section, off)
+				}
+				graphSize := uint64(again.TrailerPos + int64(len(Trailer)) - again.BlobStart)
+				if prefix := binary.LittleEndian.Uint64(out[off:]); prefix != graphSize {
+					t.Errorf("size prefix = %d, want %d", prefix, graphSize)
+				}
+				got, err := again.Graph()
+				if err != nil {
+					t.Fatalf("Graph after rewrite: %v", err)
+				}
+				assertSameGraph(t, got, want)
+			})
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package bunfmt
+
+import (
+	"io"
+	"os"
+)
+
+// Source is random access to the bytes of an executable. LoadExecutable
+// reads everything through one, so only the ranges actually needed are ever
+// pulled into memory.
+type Source interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// UseMmap makes OpenSource memory-map files where the platform supports it,
+// so reads are served from the page cache without copying. It is off by
+// default: reads then go through pread on the open file.
+var UseMmap = false
+
+// OpenSource opens path for random access. With UseMmap set the file is
+// memory-mapped, falling back to plain reads if mapping fails.
+func OpenSource(path string) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if UseMmap {
+		if src, err := mmapSource(f, fi.Size()); err == nil {
+			f.Close()
+			return src, nil
+		}
+	}
+	return &fileSource{f: f, size: fi.Size()}, nil
+}
+
+// fileSource serves reads with pread on an open file.
+type fileSource struct {
+	f    *os.File
+	size int64
+}
+
+func (s *fileSource) ReadAt(p []byte, off int64) (int, error) { return s.f.ReadAt(p, off) }
+func (s *fileSource) Size() int64                             { return s.size }
+func (s *fileSource) Close() error                            { return s.f.Close() }
+
+// bytesSource is a Source over a byte slice, including a memory mapping.
+// Reads through ReadPointer return subslices instead of copies.
+type bytesSource struct {
+	data  []byte
+	close func() error
+}
+
+// NewBytesSource returns a Source reading from data.
+func NewBytesSource(data []byte) Source {
+	return &bytesSource{data: data}
+}
+
+func (s *bytesSource) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off > int64(len(s.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (s *bytesSource) Size() int64 { return int64(len(s.data)) }
+
+func (s *bytesSource) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	err := s.close()
+	s.close, s.data = nil, nil
+	return err
+}
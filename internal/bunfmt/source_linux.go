@@ -0,0 +1,22 @@
+//go:build linux
+
+package bunfmt
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmapSource maps f read-only. The mapping outlives f, and stays valid if the
+// file is later replaced by rename.
+func mmapSource(f *os.File, size int64) (Source, error) {
+	if size <= 0 || size != int64(int(size)) {
+		return nil, errors.New("file size not mappable")
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &bytesSource{data: data, close: func() error { return syscall.Munmap(data) }}, nil
+}
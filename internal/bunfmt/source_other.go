@@ -0,0 +1,12 @@
+//go:build !linux
+
+package bunfmt
+
+import (
+	"errors"
+	"os"
+)
+
+func mmapSource(f *os.File, size int64) (Source, error) {
+	return nil, errors.New("mmap not supported on this platform")
+}
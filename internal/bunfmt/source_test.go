@@ -0,0 +1,56 @@
+package bunfmt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestOpenSource(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full")
+	if err := os.WriteFile(full, []byte("runtime"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// An empty file cannot be mapped, so it is read instead.
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		mmap       bool
+		wantMapped bool
+	}{
+		{"reads by default", full, false, false},
+		{"maps when asked", full, true, runtime.GOOS == "linux"},
+		{"falls back when mapping fails", empty, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(old bool) { UseMmap = old }(UseMmap)
+			UseMmap = tt.mmap
+
+			src, err := OpenSource(tt.path)
+			if err != nil {
+				t.Fatalf("OpenSource: %v", err)
+			}
+			defer src.Close()
+			if _, mapped := src.(*bytesSource); mapped != tt.wantMapped {
+				t.Errorf("source is %T, mapped = %t, want %t", src, mapped, tt.wantMapped)
+			}
+			want, _ := os.ReadFile(tt.path)
+			got := make([]byte, src.Size())
+			if _, err := src.ReadAt(got, 0); err != nil {
+				t.Fatalf("ReadAt: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("read %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -1,14 +1,8 @@
 package bunfmt
 
-import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
-)
-
 type StringPointer struct {
-	Offset uint32
-	Length uint32
+	Offset uint32 `json:"offset"`
+	Length uint32 `json:"length"`
 }
 
 func (sp StringPointer) Read(blob []byte) []byte {
@@ -33,7 +27,8 @@ func (sp StringPointer) Read(blob []byte) []byte {
 //	compile_exec_argv_ptr.length: u32 (4)
 //	flags:                  u32  (4)
 //
-// Total: 32 bytes
+// Total: 32 bytes. Older layouts omit trailing fields, which then read as
+// zero; see Layout.
 type OffsetsStruct struct {
 	ByteCount          uint64
 	ModulesPtr         StringPointer
@@ -42,31 +37,10 @@ type OffsetsStruct struct {
 	Flags              uint32
 }
 
-// wireOffsets is a flat struct matching the exact 32-byte wire layout.
-type wireOffsets struct {
-	ByteCount        uint64
-	ModOff, ModLen   uint32
-	EntryPointID     uint32
-	ArgvOff, ArgvLen uint32
-	Flags            uint32
-}
-
-// ReadOffsetsStruct deserializes 32 bytes into an OffsetsStruct.
+// ReadOffsetsStruct deserializes 32 bytes into an OffsetsStruct using the
+// latest layout. Use Layout.ReadOffsetsStruct for older binaries.
 func ReadOffsetsStruct(data []byte) (OffsetsStruct, error) {
-	if len(data) < OffsetsStructSize {
-		return OffsetsStruct{}, fmt.Errorf("offsets data too short: %d < %d", len(data), OffsetsStructSize)
-	}
-	var w wireOffsets
-	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &w); err != nil {
-		return OffsetsStruct{}, fmt.Errorf("parsing offsets struct: %w", err)
-	}
-	return OffsetsStruct{
-		ByteCount:          w.ByteCount,
-		ModulesPtr:         StringPointer{w.ModOff, w.ModLen},
-		EntryPointID:       w.EntryPointID,
-		CompileExecArgvPtr: StringPointer{w.ArgvOff, w.ArgvLen},
-		Flags:              w.Flags,
-	}, nil
+	return LatestLayout.ReadOffsetsStruct(data)
 }
 
 // ModuleStruct represents one 52-byte CompiledModuleGraphFile entry.
@@ -83,7 +57,8 @@ func ReadOffsetsStruct(data []byte) (OffsetsStruct, error) {
 //	module_format:         u8
 //	side:                  u8
 //
-// Total: 52 bytes
+// Total: 52 bytes. Older layouts omit trailing fields, which then read as
+// zero; see Layout.
 type ModuleStruct struct {
 	Name               StringPointer
 	Contents           StringPointer
@@ -97,35 +72,18 @@ type ModuleStruct struct {
 	Side               uint8
 }
 
-type wireModule struct {
-	NameOff, NameLen               uint32
-	ContentsOff, ContentsLen       uint32
-	MapOff, MapLen                 uint32
-	BytecodeOff, BytecodeLen       uint32
-	ModInfoOff, ModInfoLen         uint32
-	OriginOff, OriginLen           uint32
-	Encoding, Loader, ModFmt, Side uint8
+// ReadModuleStruct deserializes 52 bytes into a ModuleStruct using the latest
+// layout. Use Layout.ReadModuleStruct for older binaries.
+func ReadModuleStruct(data []byte) (ModuleStruct, error) {
+	return LatestLayout.ReadModuleStruct(data)
 }
 
-// ReadModuleStruct deserializes 52 bytes into a ModuleStruct.
-func ReadModuleStruct(data []byte) (ModuleStruct, error) {
-	if len(data) < ModuleStructSize {
-		return ModuleStruct{}, fmt.Errorf("module data too short: %d < %d", len(data), ModuleStructSize)
-	}
-	var w wireModule
-	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &w); err != nil {
-		return ModuleStruct{}, fmt.Errorf("parsing module struct: %w", err)
-	}
-	return ModuleStruct{
-		Name:               StringPointer{w.NameOff, w.NameLen},
-		Contents:           StringPointer{w.ContentsOff, w.ContentsLen},
-		SourceMap:          StringPointer{w.MapOff, w.MapLen},
-		Bytecode:           StringPointer{w.BytecodeOff, w.BytecodeLen},
-		ModuleInfo:         StringPointer{w.ModInfoOff, w.ModInfoLen},
-		BytecodeOriginPath: StringPointer{w.OriginOff, w.OriginLen},
-		Encoding:           w.Encoding,
-		Loader:             w.Loader,
-		ModuleFormat:       w.ModFmt,
-		Side:               w.Side,
-	}, nil
+// Bytes serializes the OffsetsStruct back into its 32-byte wire layout.
+func (o OffsetsStruct) Bytes() []byte {
+	return LatestLayout.OffsetsBytes(o)
+}
+
+// Bytes serializes the ModuleStruct back into its 52-byte wire layout.
+func (m ModuleStruct) Bytes() []byte {
+	return LatestLayout.ModuleStructBytes(m)
 }
@@ -0,0 +1,162 @@
+package bunfmt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Sentinel kinds for ValidationError. Match them with errors.Is.
+var (
+	ErrOutOfBounds   = errors.New("pointer out of bounds")
+	ErrOverlap       = errors.New("pointers overlap")
+	ErrMisaligned    = errors.New("pointer misaligned")
+	ErrBadEntryPoint = errors.New("entry point out of range")
+	ErrDuplicateName = errors.New("duplicate module name")
+	ErrInvalidName   = errors.New("invalid module name")
+)
+
+// ValidationError is one integrity problem found by Validate.
+type ValidationError struct {
+	Module int    // module index, or -1 for graph-level problems
+	Field  string // e.g. "contents", "modules_ptr"
+	Err    error  // one of the Err* sentinels
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	where := "graph"
+	if e.Module >= 0 {
+		where = fmt.Sprintf("module %d", e.Module)
+	}
+	if e.Field != "" {
+		where += " " + e.Field
+	}
+	if e.Detail == "" {
+		return fmt.Sprintf("%s: %v", where, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %s", where, e.Err, e.Detail)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// modulePointerFields names ModuleStruct.pointers() in wire order.
+var modulePointerFields = []string{"name", "contents", "sourcemap", "bytecode", "module_info", "bytecode_origin_path"}
+
+// span is a labelled byte range of the blob used for overlap checks.
+type span struct {
+	module int
+	field  string
+	sp     StringPointer
+}
+
+// Validate checks the graph for structural integrity: every pointer must lie
+// within the blob, no two pointers may overlap, the module table and bytecode
+// must be aligned, the entry point must name a module, and module names must
+// be unique, non-empty, valid UTF-8. It returns nil or an errors.Join of
+// *ValidationError values.
+func (exe *ExecutableData) Validate() error {
+	var errs []error
+	add := func(module int, field string, kind error, format string, args ...any) {
+		errs = append(errs, &ValidationError{Module: module, Field: field, Err: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	size := exe.Offsets.ByteCount
+	inBounds := func(sp StringPointer) bool {
+		return uint64(sp.Offset)+uint64(sp.Length) <= size
+	}
+
+	var spans []span
+	mp := exe.Offsets.ModulesPtr
+	if !inBounds(mp) {
+		add(-1, "modules_ptr", ErrOutOfBounds, "offset=%d length=%d blob=%d", mp.Offset, mp.Length, size)
+	} else {
+		spans = append(spans, span{-1, "modules_ptr", mp})
+	}
+	if mp.Offset%4 != 0 {
+		add(-1, "modules_ptr", ErrMisaligned, "offset %d is not 4-byte aligned", mp.Offset)
+	}
+	if rem := int(mp.Length) % exe.Layout.ModuleStructSize(); rem != 0 {
+		add(-1, "modules_ptr", ErrMisaligned, "length %d leaves %d trailing bytes after %d-byte entries", mp.Length, rem, exe.Layout.ModuleStructSize())
+	}
+
+	if argv := exe.Offsets.CompileExecArgvPtr; !inBounds(argv) {
+		add(-1, "compile_exec_argv_ptr", ErrOutOfBounds, "offset=%d length=%d blob=%d", argv.Offset, argv.Length, size)
+	} else {
+		spans = append(spans, span{-1, "compile_exec_argv_ptr", argv})
+	}
+
+	if int(exe.Offsets.EntryPointID) >= exe.NumModules {
+		add(-1, "entry_point_id", ErrBadEntryPoint, "%d not in [0, %d)", exe.Offsets.EntryPointID, exe.NumModules)
+	}
+
+	seen := make(map[string]int, exe.NumModules)
+	for i := 0; i < exe.NumModules; i++ {
+		m, err := exe.GetModule(i)
+		if err != nil {
+			add(i, "", ErrOutOfBounds, "%v", err)
+			continue
+		}
+		for j, sp := range m.pointers()[:exe.Layout.ModulePointers] {
+			field := modulePointerFields[j]
+			if !inBounds(*sp) {
+				add(i, field, ErrOutOfBounds, "offset=%d length=%d blob=%d", sp.Offset, sp.Length, size)
+				continue
+			}
+			spans = append(spans, span{i, field, *sp})
+		}
+		if m.Bytecode.Length > 0 && m.Bytecode.Offset%BytecodeAlignment != 0 {
+			add(i, "bytecode", ErrMisaligned, "offset %d is not %d-byte aligned", m.Bytecode.Offset, BytecodeAlignment)
+		}
+
+		if !inBounds(m.Name) {
+			continue
+		}
+		raw, err := exe.ReadPointer(m.Name)
+		if err != nil {
+			add(i, "name", ErrOutOfBounds, "%v", err)
+			continue
+		}
+		switch {
+		case len(raw) == 0:
+			add(i, "name", ErrInvalidName, "name is empty")
+		case !utf8.Valid(raw):
+			add(i, "name", ErrInvalidName, "%q is not valid UTF-8", raw)
+		default:
+			if prev, ok := seen[string(raw)]; ok {
+				add(i, "name", ErrDuplicateName, "%q already used by module %d", raw, prev)
+			} else {
+				seen[string(raw)] = i
+			}
+		}
+	}
+
+	sort.SliceStable(spans, func(a, b int) bool {
+		return spans[a].sp.Offset < spans[b].sp.Offset
+	})
+	var prev *span
+	for i := range spans {
+		cur := &spans[i]
+		if cur.sp.Length == 0 {
+			continue
+		}
+		if prev != nil && cur.sp.Offset < prev.sp.Offset+prev.sp.Length {
+			add(cur.module, cur.field, ErrOverlap, "[%d, %d) overlaps %s", cur.sp.Offset, cur.sp.Offset+cur.sp.Length, prev.label())
+		}
+		if prev == nil || cur.sp.Offset+cur.sp.Length > prev.sp.Offset+prev.sp.Length {
+			prev = cur
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *span) label() string {
+	if s.module < 0 {
+		return s.field
+	}
+	return fmt.Sprintf("module %d %s", s.module, s.field)
+}
@@ -0,0 +1,112 @@
+package bunfmt
+
+import (
+	"errors"
+	"testing"
+)
+
+// rewriteTables lets edit change the module table and offsets struct of the
+// executable in data, as a corrupt or hostile file would, and writes them
+// back in place.
+func rewriteTables(t *testing.T, data []byte, edit func(mods []ModuleStruct, o *OffsetsStruct)) {
+	t.Helper()
+	exe := loadBytes(t, data)
+	mods := make([]ModuleStruct, exe.NumModules)
+	for i := range mods {
+		m, err := exe.GetModule(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mods[i] = m
+	}
+	offsets := exe.Offsets
+	edit(mods, &offsets)
+
+	size := int64(exe.Layout.ModuleStructSize())
+	table := exe.BlobStart + int64(exe.Offsets.ModulesPtr.Offset)
+	for i, m := range mods {
+		copy(data[table+int64(i)*size:], exe.Layout.ModuleStructBytes(m))
+	}
+	copy(data[exe.TrailerPos-int64(exe.Layout.OffsetsStructSize()):], exe.Layout.OffsetsBytes(offsets))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		graph      func(g *Graph) // edits the graph before it is serialized
+		corrupt    func(mods []ModuleStruct, o *OffsetsStruct)
+		want       error
+		wantModule int
+	}{
+		{name: "writer output is valid"},
+		{
+			name:       "pointer past the blob",
+			corrupt:    func(mods []ModuleStruct, o *OffsetsStruct) { mods[2].Contents.Length = 1 << 20 },
+			want:       ErrOutOfBounds,
+			wantModule: 2,
+		},
+		{
+			name:       "overlapping contents",
+			corrupt:    func(mods []ModuleStruct, o *OffsetsStruct) { mods[2].Contents = mods[0].Contents },
+			want:       ErrOverlap,
+			wantModule: 2,
+		},
+		{
+			name:       "misaligned bytecode",
+			corrupt:    func(mods []ModuleStruct, o *OffsetsStruct) { mods[1].Bytecode.Offset++ },
+			want:       ErrMisaligned,
+			wantModule: 1,
+		},
+		{
+			name:       "entry point out of range",
+			corrupt:    func(mods []ModuleStruct, o *OffsetsStruct) { o.EntryPointID = uint32(len(mods)) },
+			want:       ErrBadEntryPoint,
+			wantModule: -1,
+		},
+		{
+			name:       "duplicate name",
+			graph:      func(g *Graph) { g.Files[3].Name = g.Files[0].Name },
+			want:       ErrDuplicateName,
+			wantModule: 3,
+		},
+		{
+			name:       "empty name",
+			graph:      func(g *Graph) { g.Files[2].Name = "" },
+			want:       ErrInvalidName,
+			wantModule: 2,
+		},
+		{
+			name:       "name is not UTF-8",
+			graph:      func(g *Graph) { g.Files[2].Name = "/$bunfs/root/\xff.js" },
+			want:       ErrInvalidName,
+			wantModule: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGraph()
+			if tt.graph != nil {
+				tt.graph(g)
+			}
+			data := buildExe(t, "runtime", g)
+			if tt.corrupt != nil {
+				rewriteTables(t, data, tt.corrupt)
+			}
+
+			err := loadBytes(t, data).Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate = %v, want %v", err, tt.want)
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || verr.Module != tt.wantModule {
+				t.Errorf("Validate = %v, want the problem reported for module %d", err, tt.wantModule)
+			}
+		})
+	}
+}
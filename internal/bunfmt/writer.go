@@ -0,0 +1,335 @@
+package bunfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// BytecodeAlignment is the boundary (relative to the blob start) that
+// bytecode payloads are padded to. JSC refuses to map unaligned bytecode.
+const BytecodeAlignment = 128
+
+// GraphFile is a CompiledModuleGraphFile with every StringPointer resolved
+// to the bytes it refers to, so that it can be edited and re-serialized.
+type GraphFile struct {
+	Name               string
+	Contents           []byte
+	SourceMap          []byte
+	Bytecode           []byte
+	ModuleInfo         []byte
+	BytecodeOriginPath []byte
+	Encoding           uint8
+	Loader             uint8
+	ModuleFormat       uint8
+	Side               uint8
+}
+
+// Graph is an editable copy of the standalone module graph.
+type Graph struct {
+	Files           []GraphFile
+	EntryPointID    uint32
+	CompileExecArgv []byte
+	Flags           uint32
+	// Layout is the wire format Serialize writes. A nil Layout means
+	// LatestLayout; graphs taken from an executable keep its layout so that
+	// the runtime embedded in it can still read them.
+	Layout *Layout
+}
+
+func (g *Graph) layout() *Layout {
+	if g.Layout == nil {
+		return LatestLayout
+	}
+	return g.Layout
+}
+
+// Graph materializes every module of exe into an editable Graph. For
+// memory-mapped executables the byte slices alias the mapping: replace them
+// rather than modifying them in place, and keep exe open until the graph has
+// been written.
+func (exe *ExecutableData) Graph() (*Graph, error) {
+	argv, err := exe.ReadPointer(exe.Offsets.CompileExecArgvPtr)
+	if err != nil {
+		return nil, fmt.Errorf("compile_exec_argv: %w", err)
+	}
+	g := &Graph{
+		Files:           make([]GraphFile, 0, exe.NumModules),
+		EntryPointID:    exe.Offsets.EntryPointID,
+		CompileExecArgv: argv,
+		Flags:           exe.Offsets.Flags,
+		Layout:          exe.Layout,
+	}
+	for i := 0; i < exe.NumModules; i++ {
+		m, err := exe.GetModule(i)
+		if err != nil {
+			return nil, err
+		}
+		f := GraphFile{
+			Encoding:     m.Encoding,
+			Loader:       m.Loader,
+			ModuleFormat: m.ModuleFormat,
+			Side:         m.Side,
+		}
+		var name []byte
+		for _, field := range []struct {
+			dst *[]byte
+			sp  StringPointer
+		}{
+			{&name, m.Name},
+			{&f.Contents, m.Contents},
+			{&f.SourceMap, m.SourceMap},
+			{&f.Bytecode, m.Bytecode},
+			{&f.ModuleInfo, m.ModuleInfo},
+			{&f.BytecodeOriginPath, m.BytecodeOriginPath},
+		} {
+			if *field.dst, err = exe.ReadPointer(field.sp); err != nil {
+				return nil, fmt.Errorf("module %d: %w", i, err)
+			}
+		}
+		f.Name = string(name)
+		g.Files = append(g.Files, f)
+	}
+	return g, nil
+}
+
+// zeros backs padding and NUL terminators in a blobPlan.
+var zeros [BytecodeAlignment]byte
+
+// blobPlan is a blob laid out but not yet copied: a list of slices that,
+// written in order, form the blob. Module data is referenced, not copied, so
+// planning a graph backed by a memory-mapped executable costs no memory.
+type blobPlan struct {
+	size   int
+	chunks [][]byte
+}
+
+func (p *blobPlan) write(b []byte) {
+	p.chunks = append(p.chunks, b)
+	p.size += len(b)
+}
+
+func (p *blobPlan) pad(align int) {
+	if rem := p.size % align; rem != 0 {
+		p.write(zeros[:align-rem])
+	}
+}
+
+// appendZ adds data followed by a NUL terminator, which Bun relies on for
+// sources handed to JSC. The terminator is not counted in the pointer.
+func (p *blobPlan) appendZ(data []byte) StringPointer {
+	if len(data) == 0 {
+		return StringPointer{}
+	}
+	sp := StringPointer{Offset: uint32(p.size), Length: uint32(len(data))}
+	p.write(data)
+	p.write(zeros[:1])
+	return sp
+}
+
+func (p *blobPlan) appendAligned(data []byte, align int) StringPointer {
+	if len(data) == 0 {
+		return StringPointer{}
+	}
+	p.pad(align)
+	sp := StringPointer{Offset: uint32(p.size), Length: uint32(len(data))}
+	p.write(data)
+	return sp
+}
+
+func (p *blobPlan) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, c := range p.chunks {
+		m, err := w.Write(c)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// plan lays out a fresh data blob for g and returns it together with the
+// OffsetsStruct describing it. Every StringPointer is recomputed.
+func (g *Graph) plan() (*blobPlan, OffsetsStruct, error) {
+	if len(g.Files) > 0 && int(g.EntryPointID) >= len(g.Files) {
+		return nil, OffsetsStruct{}, fmt.Errorf("entry point %d out of range [0, %d)", g.EntryPointID, len(g.Files))
+	}
+
+	layout := g.layout()
+	if len(g.CompileExecArgv) > 0 && !layout.HasExecArgv {
+		return nil, OffsetsStruct{}, fmt.Errorf("layout %s cannot store compile_exec_argv", layout.Name)
+	}
+
+	b := &blobPlan{}
+	argv := b.appendZ(g.CompileExecArgv)
+
+	mods := make([]ModuleStruct, len(g.Files))
+	for i, f := range g.Files {
+		mods[i] = ModuleStruct{
+			Name:               b.appendZ([]byte(f.Name)),
+			Contents:           b.appendZ(f.Contents),
+			SourceMap:          b.appendZ(f.SourceMap),
+			ModuleInfo:         b.appendZ(f.ModuleInfo),
+			BytecodeOriginPath: b.appendZ(f.BytecodeOriginPath),
+			Bytecode:           b.appendAligned(f.Bytecode, BytecodeAlignment),
+			Encoding:           f.Encoding,
+			Loader:             f.Loader,
+			ModuleFormat:       f.ModuleFormat,
+			Side:               f.Side,
+		}
+	}
+
+	for i, m := range mods {
+		for _, sp := range m.pointers()[layout.ModulePointers:] {
+			if sp.Length > 0 {
+				return nil, OffsetsStruct{}, fmt.Errorf("module %q uses fields that layout %s cannot store", g.Files[i].Name, layout.Name)
+			}
+		}
+	}
+
+	b.pad(4)
+	modulesStart := b.size
+	for _, m := range mods {
+		b.write(layout.ModuleStructBytes(m))
+	}
+	if uint64(b.size) > 1<<32-1 {
+		return nil, OffsetsStruct{}, fmt.Errorf("serialized blob is %d bytes, which exceeds the 4 GiB pointer range", b.size)
+	}
+
+	offsets := OffsetsStruct{
+		ByteCount:          uint64(b.size),
+		ModulesPtr:         StringPointer{Offset: uint32(modulesStart), Length: uint32(b.size - modulesStart)},
+		EntryPointID:       g.EntryPointID,
+		CompileExecArgvPtr: argv,
+		Flags:              g.Flags,
+	}
+	return b, offsets, nil
+}
+
+// Serialize lays out a fresh data blob for g and returns it together with the
+// OffsetsStruct describing it. Every StringPointer is recomputed.
+func (g *Graph) Serialize() ([]byte, OffsetsStruct, error) {
+	p, offsets, err := g.plan()
+	if err != nil {
+		return nil, OffsetsStruct{}, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(p.size)
+	p.WriteTo(&buf)
+	return buf.Bytes(), offsets, nil
+}
+
+// WriteExecutable streams a copy of the executable to w with its module graph
+// replaced by g: everything before the blob, the re-serialized graph, and
+// whatever followed the trailer. When the bytes after the trailer are Bun's
+// u64 total-size footer it is updated to describe the new image.
+func (exe *ExecutableData) WriteExecutable(w io.Writer, g *Graph) error {
+	p, offsets, err := g.plan()
+	if err != nil {
+		return err
+	}
+	offsetsBytes := g.layout().OffsetsBytes(offsets)
+	oldGraphSize := exe.Offsets.ByteCount + uint64(exe.Layout.OffsetsStructSize()+len(Trailer))
+	newGraphSize := uint64(p.size + len(offsetsBytes) + len(Trailer))
+
+	if exe.Section != nil {
+		return exe.writeInSection(w, p, offsetsBytes, oldGraphSize, newGraphSize)
+	}
+
+	if err := exe.copyRange(w, 0, exe.BlobStart); err != nil {
+		return err
+	}
+	if err := writeGraph(w, p, offsetsBytes); err != nil {
+		return err
+	}
+
+	trailerEnd := exe.TrailerPos + int64(len(Trailer))
+	tailLen := exe.Src.Size() - trailerEnd
+	if tailLen != 8 {
+		return exe.copyRange(w, trailerEnd, exe.Src.Size())
+	}
+	tail := make([]byte, 8)
+	if _, err := exe.Src.ReadAt(tail, trailerEnd); err != nil {
+		return fmt.Errorf("reading size footer: %w", err)
+	}
+	switch binary.LittleEndian.Uint64(tail) {
+	case uint64(exe.Src.Size()):
+		binary.LittleEndian.PutUint64(tail, uint64(exe.BlobStart)+newGraphSize+8)
+	case oldGraphSize:
+		binary.LittleEndian.PutUint64(tail, newGraphSize)
+	}
+	_, err = w.Write(tail)
+	return err
+}
+
+// writeInSection writes the graph back into the container section it was
+// loaded from. Sections cannot grow without relinking the executable, so the
+// new graph has to fit between the blob start and the end of the section.
+func (exe *ExecutableData) writeInSection(w io.Writer, p *blobPlan, offsetsBytes []byte, oldGraphSize, newGraphSize uint64) error {
+	sec := exe.Section
+	if room := uint64(sec.End() - exe.BlobStart); newGraphSize > room {
+		return fmt.Errorf("rebuilt graph needs %d bytes but the %s section %s only has room for %d", newGraphSize, sec.Format, sec.Name, room)
+	}
+
+	prefixEnd := exe.BlobStart
+	var sizePrefix []byte
+	if at := exe.BlobStart - sectionSizePrefix; at >= sec.Offset {
+		buf := make([]byte, sectionSizePrefix)
+		if _, err := exe.Src.ReadAt(buf, at); err != nil {
+			return fmt.Errorf("reading section size prefix: %w", err)
+		}
+		if binary.LittleEndian.Uint64(buf) == oldGraphSize {
+			binary.LittleEndian.PutUint64(buf, newGraphSize)
+			prefixEnd, sizePrefix = at, buf
+		}
+	}
+	if err := exe.copyRange(w, 0, prefixEnd); err != nil {
+		return err
+	}
+	if _, err := w.Write(sizePrefix); err != nil {
+		return err
+	}
+	if err := writeGraph(w, p, offsetsBytes); err != nil {
+		return err
+	}
+
+	pos := exe.BlobStart + int64(newGraphSize)
+	if oldEnd := exe.TrailerPos + int64(len(Trailer)); pos < oldEnd {
+		if _, err := io.CopyN(w, zeroReader{}, oldEnd-pos); err != nil {
+			return err
+		}
+		pos = oldEnd
+	}
+	return exe.copyRange(w, pos, exe.Src.Size())
+}
+
+func writeGraph(w io.Writer, p *blobPlan, offsetsBytes []byte) error {
+	if _, err := p.WriteTo(w); err != nil {
+		return err
+	}
+	if _, err := w.Write(offsetsBytes); err != nil {
+		return err
+	}
+	_, err := w.Write(Trailer)
+	return err
+}
+
+// copyRange copies bytes [start, end) of the source executable to w.
+func (exe *ExecutableData) copyRange(w io.Writer, start, end int64) error {
+	if end <= start {
+		return nil
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(exe.Src, start, end-start)); err != nil {
+		return fmt.Errorf("copying executable bytes [%d, %d): %w", start, end, err)
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,187 @@
+package bunfmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testGraph returns a small graph that exercises every module field the
+// latest layout stores.
+func testGraph() *Graph {
+	return &Graph{
+		EntryPointID:    1,
+		CompileExecArgv: []byte("--smol"),
+		Flags:           1,
+		Files: []GraphFile{
+			{Name: "/$bunfs/root/worker.js", Contents: []byte("self.onmessage = () => {};\n"), Encoding: 2, Loader: 1, ModuleFormat: 2},
+			{
+				Name:               "/$bunfs/root/cli.js",
+				Contents:           []byte("import {a} from './b.js';\nconsole.log(a);\n"),
+				SourceMap:          []byte(`{"version":3,"sources":["cli.ts"],"mappings":"AAAA"}`),
+				Bytecode:           bytes.Repeat([]byte{0xbc}, 300),
+				ModuleInfo:         []byte{0, 0, 0, 0},
+				BytecodeOriginPath: []byte("/$bunfs/root/cli.js"),
+				Encoding:           2,
+				Loader:             1,
+				ModuleFormat:       1,
+			},
+			{Name: "/$bunfs/root/data.json", Contents: []byte(`{"x":1}`), Encoding: 2, Loader: 6},
+			{Name: "/$bunfs/root/empty.txt", Encoding: 2, Loader: 13, Side: 1},
+		},
+	}
+}
+
+// graphBytes returns g the way Bun stores it: the blob, the offsets struct
+// and the trailer.
+func graphBytes(t *testing.T, g *Graph) []byte {
+	t.Helper()
+	blob, offsets, err := g.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	out := append(blob, g.layout().OffsetsBytes(offsets)...)
+	return append(out, Trailer...)
+}
+
+// buildExe lays g out the way bun build --compile appends it: a runtime
+// image, the graph and the u64 total-size footer.
+func buildExe(t *testing.T, runtime string, g *Graph) []byte {
+	t.Helper()
+	out := append([]byte(runtime), graphBytes(t, g)...)
+	return binary.LittleEndian.AppendUint64(out, uint64(len(out)+8))
+}
+
+func layoutNamed(name string) *Layout {
+	for _, l := range Layouts {
+		if l.Name == name {
+			return l
+		}
+	}
+	panic("no layout " + name)
+}
+
+func loadBytes(t *testing.T, data []byte) *ExecutableData {
+	t.Helper()
+	exe, err := Load(NewBytesSource(data), false)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return exe
+}
+
+func assertSameGraph(t *testing.T, got, want *Graph) {
+	t.Helper()
+	if got.EntryPointID != want.EntryPointID || got.Flags != want.Flags || !bytes.Equal(got.CompileExecArgv, want.CompileExecArgv) {
+		t.Errorf("graph header = (%d, %d, %q), want (%d, %d, %q)",
+			got.EntryPointID, got.Flags, got.CompileExecArgv, want.EntryPointID, want.Flags, want.CompileExecArgv)
+	}
+	if len(got.Files) != len(want.Files) {
+		t.Fatalf("got %d files, want %d", len(got.Files), len(want.Files))
+	}
+	for i := range want.Files {
+		g, w := got.Files[i], want.Files[i]
+		if g.Name != w.Name || g.Encoding != w.Encoding || g.Loader != w.Loader || g.ModuleFormat != w.ModuleFormat || g.Side != w.Side {
+			t.Errorf("file %d = %q %d/%d/%d/%d, want %q %d/%d/%d/%d", i,
+				g.Name, g.Encoding, g.Loader, g.ModuleFormat, g.Side, w.Name, w.Encoding, w.Loader, w.ModuleFormat, w.Side)
+		}
+		for _, field := range []struct {
+			name      string
+			got, want []byte
+		}{
+			{"contents", g.Contents, w.Contents},
+			{"sourcemap", g.SourceMap, w.SourceMap},
+			{"bytecode", g.Bytecode, w.Bytecode},
+			{"module_info", g.ModuleInfo, w.ModuleInfo},
+			{"bytecode_origin_path", g.BytecodeOriginPath, w.BytecodeOriginPath},
+		} {
+			if !bytes.Equal(field.got, field.want) {
+				t.Errorf("file %d %s = %q, want %q", i, field.name, field.got, field.want)
+			}
+		}
+	}
+}
+
+func TestGraphRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph func() *Graph
+	}{
+		{"full", testGraph},
+		{"single module", func() *Graph {
+			return &Graph{Files: []GraphFile{{Name: "/$bunfs/root/a.js", Contents: []byte("1"), Encoding: 2, Loader: 1}}}
+		}},
+		{"v1.0 layout", func() *Graph {
+			g := testGraph()
+			g.Layout = layoutNamed("v1.0")
+			g.CompileExecArgv, g.Flags = nil, 0
+			for i := range g.Files {
+				g.Files[i].Bytecode, g.Files[i].ModuleInfo, g.Files[i].BytecodeOriginPath = nil, nil, nil
+				g.Files[i].ModuleFormat, g.Files[i].Side = 0, 0
+			}
+			return g
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.graph()
+			exe := loadBytes(t, buildExe(t, "runtime image", want))
+			if exe.Layout != want.layout() {
+				t.Errorf("loaded as layout %s, want %s", exe.Layout.Name, want.layout().Name)
+			}
+			if err := exe.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			got, err := exe.Graph()
+			if err != nil {
+				t.Fatalf("Graph: %v", err)
+			}
+			assertSameGraph(t, got, want)
+
+			// Writing the graph back must give a loadable executable with
+			// the same graph.
+			var buf bytes.Buffer
+			if err := exe.WriteExecutable(&buf, got); err != nil {
+				t.Fatalf("WriteExecutable: %v", err)
+			}
+			again, err := loadBytes(t, buf.Bytes()).Graph()
+			if err != nil {
+				t.Fatalf("Graph after rewrite: %v", err)
+			}
+			assertSameGraph(t, again, want)
+			if size := binary.LittleEndian.Uint64(buf.Bytes()[buf.Len()-8:]); size != uint64(buf.Len()) {
+				t.Errorf("size footer = %d, want %d", size, buf.Len())
+			}
+		})
+	}
+}
+
+func TestSerializeAlignsBytecode(t *testing.T) {
+	g := testGraph()
+	exe := loadBytes(t, buildExe(t, "x", g))
+	m, err := exe.GetModule(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bytecode.Offset%BytecodeAlignment != 0 {
+		t.Errorf("bytecode offset %d is not %d-byte aligned", m.Bytecode.Offset, BytecodeAlignment)
+	}
+}
+
+func TestSerializeRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph *Graph
+	}{
+		{"entry point out of range", &Graph{EntryPointID: 1, Files: []GraphFile{{Name: "a"}}}},
+		{"argv in v1.0", &Graph{Layout: layoutNamed("v1.0"), CompileExecArgv: []byte("--smol"), Files: []GraphFile{{Name: "a"}}}},
+		{"bytecode in v1.0", &Graph{Layout: layoutNamed("v1.0"), Files: []GraphFile{{Name: "a", Bytecode: []byte{1}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := tt.graph.Serialize(); err == nil {
+				t.Error("Serialize succeeded, want an error")
+			}
+		})
+	}
+}
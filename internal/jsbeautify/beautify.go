@@ -0,0 +1,376 @@
+// Package jsbeautify pretty-prints JavaScript and TypeScript, such as the
+// minified bundles embedded in a standalone Bun executable. It only changes
+// the whitespace between tokens: every token, comment and line break of the
+// source is kept, so automatic semicolon insertion sees the same code.
+package jsbeautify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Indent is the indentation of each nesting level.
+const Indent = "    "
+
+// Beautify returns src re-indented with one statement per line. It fails on
+// source it cannot tokenize, such as an unterminated string, and checks that
+// its output tokenizes exactly like src.
+func Beautify(src []byte) ([]byte, error) {
+	p := &printer{out: make([]byte, 0, len(src)+len(src)/4), frames: []printFrame{{}}}
+	l := newLexer(string(src))
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind == EOF {
+			break
+		}
+		p.print(t)
+	}
+	p.out = append(p.out, '\n')
+	if err := sameTokens(string(src), string(p.out)); err != nil {
+		return nil, fmt.Errorf("internal error: %w", err)
+	}
+	return p.out, nil
+}
+
+// sameTokens checks that b has the tokens of a.
+func sameTokens(a, b string) error {
+	la, lb := newLexer(a), newLexer(b)
+	for {
+		ta, err := la.next()
+		if err != nil {
+			return err
+		}
+		tb, err := lb.next()
+		if err != nil {
+			return fmt.Errorf("output: %w", err)
+		}
+		if ta.Kind != tb.Kind || ta.Text != tb.Text {
+			return lb.errorf("output has %q where the source has %q", tb.Text, ta.Text)
+		}
+		if ta.Kind == EOF {
+			return nil
+		}
+	}
+}
+
+type printFrame struct {
+	open      byte // (, [, { or $ for a template substitution
+	object    bool
+	inline    bool   // for {: a pattern or import list kept on one line
+	keyword   string // for (: the keyword before it, e.g. "if"
+	isSwitch  bool   // for {: the body of a switch
+	doBody    bool   // for {: the body of a do-while
+	inCase    bool   // a case label has been seen in this switch body
+	caseLabel bool   // a case label awaits its :
+	ternary   int
+}
+
+type printer struct {
+	out    []byte
+	frames []printFrame
+
+	prev      Token // last significant token
+	prevProp  bool  // prev is a property name
+	prevUnary bool  // prev is a prefix operator
+	prevPost  bool  // prev is a postfix ++ or --
+	comment   Kind  // kind of the last token if it was a comment, else EOF
+
+	breakAfter bool // the next token starts a new line
+	blockEnd   bool // prev closed a block; see continuesBlock
+	doEnd      bool // ... which was the body of a do-while
+	lastParen  string
+}
+
+func (p *printer) top() *printFrame { return &p.frames[len(p.frames)-1] }
+
+func (p *printer) print(t Token) {
+	if t.Kind == LineComment || t.Kind == BlockComment {
+		p.printComment(t)
+		return
+	}
+
+	var kw string
+	if t.Kind == Word && !p.prevProp {
+		kw = t.Text
+	}
+	unary := p.isUnary(t)
+	closing := t.Kind == Punct && (t.Text == ")" || t.Text == "]" || t.Text == "}") ||
+		t.Kind == Template && t.Text[0] == '}'
+	emptyBrace := t.Kind == Punct && t.Text == "}" && p.prev.Kind == Punct && p.prev.Text == "{" && p.comment == EOF && len(p.out) > 0 && p.out[len(p.out)-1] == '{'
+
+	var popped printFrame
+	if closing && len(p.frames) > 1 {
+		popped = *p.top()
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+
+	// A case or default label starts a line of a switch body.
+	isCase := false
+	if f := p.top(); f.isSwitch && (kw == "case" || kw == "default") && (p.breakAfter || p.blockEnd) {
+		isCase = true
+		f.inCase, f.caseLabel = true, true
+	}
+
+	newline := t.Newlines > 0 || p.comment == LineComment || p.breakAfter
+	switch {
+	case emptyBrace:
+		newline = false
+	case t.Kind == Punct && t.Text == "}":
+		newline = !popped.inline || t.Newlines > 0
+	case p.blockEnd && !newline:
+		newline = !p.continuesBlock(t, unary)
+	}
+	if len(p.out) == 0 {
+		newline = false
+	}
+
+	if newline {
+		if t.Newlines > 1 {
+			p.out = append(p.out, '\n')
+		}
+		p.out = append(p.out, '\n')
+		// Inside brackets, only line breaks kept from the source continue the
+		// expression one level deeper.
+		depth := p.depth(t.Newlines > 0 && !p.breakAfter && !closing)
+		if isCase {
+			depth--
+		}
+		for i := 0; i < depth; i++ {
+			p.out = append(p.out, Indent...)
+		}
+	} else if len(p.out) > 0 && (p.comment != EOF || p.needSpace(t, unary)) {
+		p.out = append(p.out, ' ')
+	}
+	p.out = append(p.out, t.Text...)
+
+	p.breakAfter, p.blockEnd, p.doEnd = false, false, false
+	p.prevUnary = unary
+	p.prevPost = t.Kind == Punct && (t.Text == "++" || t.Text == "--") && !unary
+	p.comment = EOF
+
+	switch t.Kind {
+	case Template:
+		if t.Opens {
+			p.frames = append(p.frames, printFrame{open: '$'})
+		}
+	case Punct:
+		switch t.Text {
+		case "(":
+			p.frames = append(p.frames, printFrame{open: '(', keyword: p.keyword()})
+		case "[":
+			p.frames = append(p.frames, printFrame{open: '['})
+		case "{":
+			f := printFrame{open: '{', object: t.Object}
+			switch p.keyword() {
+			case "import", "export", "const", "let", "var":
+				f.inline = t.Object
+			default:
+				f.inline = t.Object && p.top().inline
+			}
+			if p.prev.Kind == Punct && p.prev.Text == ")" {
+				f.isSwitch = p.lastParen == "switch"
+			}
+			f.doBody = p.keyword() == "do"
+			p.frames = append(p.frames, f)
+			p.breakAfter = !f.inline
+		case ")":
+			p.lastParen = popped.keyword
+		case "}":
+			if !t.Object {
+				p.blockEnd, p.doEnd = true, popped.doBody
+			}
+		case ";":
+			if p.top().open == '{' || len(p.frames) == 1 {
+				p.breakAfter = true
+			}
+		case ",":
+			if f := p.top(); f.open == '{' && f.object && !f.inline {
+				p.breakAfter = true
+			}
+		case "?":
+			p.top().ternary++
+		case ":":
+			if f := p.top(); f.ternary > 0 {
+				f.ternary--
+			} else if f.caseLabel {
+				f.caseLabel = false
+				p.breakAfter = true
+			}
+		}
+	}
+	p.prev, p.prevProp = t, t.Kind == Punct && (t.Text == "." || t.Text == "?.")
+}
+
+func (p *printer) printComment(t Token) {
+	switch {
+	case len(p.out) == 0:
+	case t.Newlines > 0 || p.comment == LineComment:
+		if t.Newlines > 1 {
+			p.out = append(p.out, '\n')
+		}
+		p.out = append(p.out, '\n')
+		for i := 0; i < p.depth(t.Newlines > 0); i++ {
+			p.out = append(p.out, Indent...)
+		}
+	default:
+		p.out = append(p.out, ' ')
+	}
+	p.out = append(p.out, t.Text...)
+	p.comment = t.Kind
+}
+
+// depth returns the indentation of a new line, one level deeper inside
+// brackets if it continues an expression.
+func (p *printer) depth(cont bool) int {
+	d := 0
+	for _, f := range p.frames {
+		if f.open == '{' {
+			d++
+			if f.inCase {
+				d++
+			}
+		}
+	}
+	if f := p.top(); cont && (f.open == '(' || f.open == '[') {
+		d++
+	}
+	return d
+}
+
+// keyword returns the previous token if it is a keyword-like word.
+func (p *printer) keyword() string {
+	if p.prev.Kind == Word && !p.prevProp {
+		return p.prev.Text
+	}
+	return ""
+}
+
+// operand reports whether the previous token ends an operand, so that a
+// following + or - is binary.
+func (p *printer) operand() bool {
+	switch p.prev.Kind {
+	case Word:
+		return p.prevProp || !regexKeywords[p.prev.Text]
+	case Number, String, Regexp:
+		return true
+	case Template:
+		return !p.prev.Opens
+	case Punct:
+		switch p.prev.Text {
+		case ")", "]", "}":
+			return true
+		case "++", "--":
+			return p.prevPost
+		}
+	}
+	return false
+}
+
+// isUnary reports whether t is a prefix operator.
+func (p *printer) isUnary(t Token) bool {
+	if t.Kind != Punct {
+		return false
+	}
+	switch t.Text {
+	case "!", "~", "...":
+		return true
+	case "+", "-":
+		return !p.operand()
+	case "++", "--":
+		return !p.operand() || t.Newlines > 0
+	}
+	return false
+}
+
+// continuesBlock reports whether t continues the statement or expression
+// that a closing brace was part of, rather than starting a new statement.
+func (p *printer) continuesBlock(t Token, unary bool) bool {
+	switch t.Kind {
+	case Word:
+		return !p.prevProp && (t.Text == "else" || t.Text == "catch" || t.Text == "finally" || t.Text == "while" && p.doEnd)
+	case Template:
+		return t.Text[0] == '}'
+	case Punct:
+		return !unary && t.Text != "{" && t.Text != "@" && t.Text != "#"
+	}
+	return false
+}
+
+// needSpace reports whether t is printed apart from the token before it on
+// the same line.
+func (p *printer) needSpace(t Token, unary bool) bool {
+	prev := p.prev
+	if mustSeparate(prev, t) {
+		return true
+	}
+	// No space after openers and prefix operators.
+	if p.prevUnary || p.prevProp {
+		return false
+	}
+	if prev.Kind == Template && prev.Opens {
+		return false
+	}
+	if prev.Kind == Punct {
+		switch prev.Text {
+		case "(", "[", ".", "?.", "#", "@":
+			return false
+		case "{":
+			return t.Kind != Punct || t.Text != "}"
+		}
+	}
+
+	switch t.Kind {
+	case Template:
+		if t.Text[0] == '}' {
+			return false
+		}
+		// A tagged template stays next to its tag.
+		return !p.operand() || prev.Kind == Word && regexKeywords[prev.Text]
+	case Punct:
+		switch t.Text {
+		case ")", "]", ";", ",", ".", "?.":
+			return false
+		case "++", "--":
+			return unary
+		case ":":
+			f := p.top()
+			return f.ternary > 0
+		case "(", "[":
+			if prev.Kind == Word {
+				return !p.prevProp && (regexKeywords[prev.Text] || controlKeywords[prev.Text])
+			}
+			return !p.operand()
+		}
+		return true
+	}
+	return true
+}
+
+// controlKeywords are followed by a parenthesized condition or header, or a
+// destructuring pattern.
+var controlKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "with": true,
+	"var": true, "let": true, "const": true,
+}
+
+// mustSeparate reports whether a and b would run together into different
+// tokens if printed without a space.
+func mustSeparate(a, b Token) bool {
+	word := func(t Token) bool { return t.Kind == Word || t.Kind == Number }
+	switch {
+	case (word(a) || a.Kind == Regexp) && word(b):
+		return true
+	case a.Kind == Number && strings.HasPrefix(b.Text, "."):
+		return true
+	case strings.HasSuffix(a.Text, "/") && (b.Text[0] == '/' || b.Text[0] == '*'):
+		return true // // or /* starts a comment
+	case a.Kind == Punct && b.Kind == Punct:
+		return punctLen(a.Text+b.Text) > len(a.Text)
+	case strings.HasSuffix(a.Text, "<") && strings.HasPrefix(b.Text, "!"):
+		return true // <!-- starts a comment in scripts
+	}
+	return false
+}
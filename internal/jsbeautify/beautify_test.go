@@ -0,0 +1,137 @@
+package jsbeautify
+
+import "testing"
+
+func lex(t *testing.T, src string) []Token {
+	t.Helper()
+	l := newLexer(src)
+	var toks []Token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			t.Fatalf("lexing %q: %v", src, err)
+		}
+		if tok.Kind == EOF {
+			return toks
+		}
+		toks = append(toks, tok)
+	}
+}
+
+var beautifyTests = []struct {
+	name string
+	src  string
+	want string
+}{
+	{
+		name: "blocks",
+		src:  `function f(a,b){if(a){return b}else{return a/2}}`,
+		want: "function f(a, b) {\n    if (a) {\n        return b\n    } else {\n        return a / 2\n    }\n}\n",
+	},
+	{
+		name: "object literal",
+		src:  `var o={a:1,b:[1,2,{c:3}]};`,
+		want: "var o = {\n    a: 1,\n    b: [1, 2, {\n        c: 3\n    }]\n};\n",
+	},
+	{
+		name: "nested template",
+		src:  "let s=`x${a+`y${b}`}z`;",
+		want: "let s = `x${a + `y${b}`}z`;\n",
+	},
+	{
+		name: "division and regexp",
+		src:  `x=a/b/c;y=/re[/]x/g.test(s)`,
+		want: "x = a / b / c;\ny = /re[/]x/g.test(s)\n",
+	},
+	{
+		name: "for loop",
+		src:  `for(let i=0;i<n;i++){a++;--b}`,
+		want: "for (let i = 0; i < n; i++) {\n    a++;\n    --b\n}\n",
+	},
+	{
+		name: "line break before ++ is kept",
+		src:  "a\n++b",
+		want: "a\n++b\n",
+	},
+	{
+		name: "comments",
+		src:  "// c\n/* d */a()",
+		want: "// c\n/* d */ a()\n",
+	},
+	{
+		name: "arrow and optional chaining",
+		src:  `const g=async(x)=>x?.y??await h(...x)`,
+	},
+	{
+		name: "class",
+		src:  `class A extends B{#p=1;static get x(){return this.#p}}`,
+	},
+	{
+		name: "strings with escapes",
+		src:  `s="a\"b"+'c\'d'+"é"`,
+	},
+	{
+		name: "return object",
+		src:  `function f(){return{a:1}}`,
+	},
+	{
+		name: "adjacent operators",
+		src:  `a=b- -c+ +d;e=f---g`,
+	},
+}
+
+func TestBeautify(t *testing.T) {
+	for _, tt := range beautifyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Beautify([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Beautify: %v", err)
+			}
+			if tt.want != "" && string(out) != tt.want {
+				t.Errorf("Beautify =\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+// Beautify may only change whitespace: the output must have the same tokens
+// and keep every line break of the source.
+func TestBeautifyPreservesTokens(t *testing.T) {
+	for _, tt := range beautifyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Beautify([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Beautify: %v", err)
+			}
+			src, got := lex(t, tt.src), lex(t, string(out))
+			if len(src) != len(got) {
+				t.Fatalf("output has %d tokens, source has %d", len(got), len(src))
+			}
+			for i := range src {
+				if src[i].Kind != got[i].Kind || src[i].Text != got[i].Text {
+					t.Errorf("token %d = %q (kind %d), source has %q (kind %d)", i, got[i].Text, got[i].Kind, src[i].Text, src[i].Kind)
+				}
+				if src[i].Newlines > 0 && got[i].Newlines == 0 {
+					t.Errorf("line break before token %d (%q) was dropped", i, src[i].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestBeautifyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"unterminated string", `a="b`},
+		{"unterminated template", "a=`b${c}"},
+		{"unterminated comment", `a/* b`},
+		{"unterminated regexp", `a=/b`},
+	}
+	for _, tt := range tests {
+		if _, err := Beautify([]byte(tt.src)); err == nil {
+			t.Errorf("%s: Beautify(%q) succeeded, want an error", tt.name, tt.src)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package jsbeautify
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind classifies a token.
+type Kind uint8
+
+const (
+	EOF      Kind = iota
+	Word          // identifier, keyword or #private name
+	Number        // numeric literal
+	String        // quoted string literal
+	Template      // template literal, or the part of one before a ${ or after its }
+	Regexp        // regular expression literal
+	Punct         // operator or punctuation
+	LineComment
+	BlockComment
+)
+
+// Token is one token of the source. Text is a slice of the source, so
+// concatenating every token with the whitespace between them gives it back.
+type Token struct {
+	Kind     Kind
+	Text     string
+	Newlines int // line breaks between the previous token and this one
+
+	// Object marks the braces of object literals and patterns, as opposed to
+	// blocks and bodies.
+	Object bool
+	// Opens marks a template part that ends in ${.
+	Opens bool
+}
+
+// regexKeywords are the keywords after which a / starts a regular expression
+// rather than a division.
+var regexKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true,
+	"new": true, "delete": true, "void": true, "throw": true, "case": true,
+	"do": true, "else": true, "yield": true, "await": true,
+}
+
+// objectKeywords are the keywords after which a { opens an object literal or
+// pattern.
+var objectKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true,
+	"new": true, "delete": true, "void": true, "throw": true, "case": true,
+	"yield": true, "await": true, "var": true, "let": true, "const": true,
+	"import": true, "export": true, "default": true,
+}
+
+var puncts = [...]map[string]bool{
+	4: {">>>=": true},
+	3: {"===": true, "!==": true, "**=": true, "<<=": true, ">>=": true, ">>>": true,
+		"...": true, "&&=": true, "||=": true, "??=": true},
+	2: {"=>": true, "==": true, "!=": true, "<=": true, ">=": true, "&&": true,
+		"||": true, "??": true, "?.": true, "++": true, "--": true, "+=": true,
+		"-=": true, "*=": true, "/=": true, "%=": true, "&=": true, "|=": true,
+		"^=": true, "**": true, "<<": true, ">>": true},
+}
+
+// punctLen returns the length of the punctuator at the start of s.
+func punctLen(s string) int {
+	for n := 4; n >= 2; n-- {
+		if len(s) >= n && puncts[n][s[:n]] {
+			if s[:n] == "?." && len(s) > 2 && isDigit(s[2]) {
+				continue // a ? .5 : b
+			}
+			return n
+		}
+	}
+	return 1
+}
+
+type lexFrame struct {
+	open       byte // (, [, { or $ for a template substitution
+	object     bool // for {: see Token.Object
+	regexAfter bool // for (: the condition of if, while, for or with
+	ternary    int  // ?s awaiting their :
+}
+
+// lexer splits JavaScript into tokens. Whether a / starts a regular
+// expression depends on what precedes it, which the lexer tracks with a stack
+// of open brackets; like every tool that does not fully parse, it guesses
+// after ) and }.
+type lexer struct {
+	src    string
+	pos    int
+	frames []lexFrame
+
+	regexOK bool // a / here starts a regular expression
+	prev    Token
+	prop    bool // prev is a property name after . or ?.
+	colon   bool // prev is a : that ends a case or label
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, frames: []lexFrame{{}}, regexOK: true}
+}
+
+func (l *lexer) top() *lexFrame { return &l.frames[len(l.frames)-1] }
+
+func (l *lexer) errorf(format string, args ...any) error {
+	line := 1 + strings.Count(l.src[:l.pos], "\n")
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// next returns the next token, or one of kind EOF at the end of the source.
+func (l *lexer) next() (Token, error) {
+	nl := l.skipSpace()
+	if l.pos >= len(l.src) {
+		if len(l.frames) > 1 {
+			return Token{}, l.errorf("unclosed %c", l.top().open)
+		}
+		return Token{Kind: EOF, Newlines: nl}, nil
+	}
+	start := l.pos
+	t := Token{Newlines: nl}
+	var err error
+	switch c := l.src[l.pos]; {
+	case c == '/' && l.peek(1) == '/', c == '#' && l.pos == 0 && l.peek(1) == '!':
+		t.Kind = LineComment
+		l.skipLine()
+	case c == '/' && l.peek(1) == '*':
+		t.Kind = BlockComment
+		end := strings.Index(l.src[l.pos+2:], "*/")
+		if end < 0 {
+			return Token{}, l.errorf("unterminated comment")
+		}
+		l.pos += 2 + end + 2
+	case c == '"' || c == '\'':
+		t.Kind = String
+		err = l.scanString(c)
+	case c == '`':
+		t.Kind = Template
+		t.Opens, err = l.scanTemplate()
+	case isDigit(c) || c == '.' && isDigit(l.peek(1)):
+		t.Kind = Number
+		l.scanNumber()
+	case c == '/' && l.regexOK:
+		t.Kind = Regexp
+		err = l.scanRegexp()
+	case c == '}' && l.top().open == '$':
+		t.Kind = Template
+		l.frames = l.frames[:len(l.frames)-1]
+		t.Opens, err = l.scanTemplate()
+	case c == '#' || c == '\\' || c >= utf8.RuneSelf || isIdentStart(c):
+		t.Kind = Word
+		l.pos++
+		l.scanIdent()
+	default:
+		t.Kind = Punct
+		l.pos += punctLen(l.src[l.pos:])
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	t.Text = l.src[start:l.pos]
+	if t.Kind != LineComment && t.Kind != BlockComment {
+		if err := l.track(&t); err != nil {
+			return Token{}, err
+		}
+	}
+	return t, nil
+}
+
+// track updates the bracket stack and the regexp state for significant
+// token t.
+func (l *lexer) track(t *Token) error {
+	prop := l.prop
+	l.prop = false
+	colon := l.colon
+	l.colon = false
+	switch t.Kind {
+	case Word:
+		l.regexOK = !prop && regexKeywords[t.Text]
+	case Number, String, Regexp:
+		l.regexOK = false
+	case Template:
+		if t.Opens {
+			l.frames = append(l.frames, lexFrame{open: '$'})
+		}
+		l.regexOK = t.Opens
+	case Punct:
+		l.regexOK = true
+		switch t.Text {
+		case ".", "?.":
+			l.prop = true
+		case "(":
+			kw := l.prev.Kind == Word && !prop
+			l.frames = append(l.frames, lexFrame{open: '(', regexAfter: kw && (l.prev.Text == "if" || l.prev.Text == "while" || l.prev.Text == "for" || l.prev.Text == "with")})
+		case "[":
+			l.frames = append(l.frames, lexFrame{open: '['})
+		case "{":
+			t.Object = l.braceIsObject(prop, colon)
+			l.frames = append(l.frames, lexFrame{open: '{', object: t.Object})
+		case ")", "]", "}":
+			f := l.top()
+			if len(l.frames) == 1 || closer(f.open) != t.Text[0] {
+				return l.errorf("unexpected %s", t.Text)
+			}
+			l.frames = l.frames[:len(l.frames)-1]
+			switch t.Text {
+			case ")":
+				l.regexOK = f.regexAfter
+			case "]":
+				l.regexOK = false
+			case "}":
+				t.Object = f.object
+				l.regexOK = !f.object
+			}
+		case "++", "--":
+			l.regexOK = false
+		case "?":
+			l.top().ternary++
+		case ":":
+			if f := l.top(); f.ternary > 0 {
+				f.ternary--
+			} else if !f.object && f.open != '(' {
+				l.colon = true
+			}
+		}
+	}
+	l.prev = *t
+	return nil
+}
+
+// braceIsObject guesses from the previous token whether a { opens an object
+// literal or pattern rather than a block or body.
+func (l *lexer) braceIsObject(prop, colon bool) bool {
+	p := l.prev
+	switch p.Kind {
+	case Word:
+		return !prop && objectKeywords[p.Text]
+	case Template:
+		return p.Opens
+	case Punct:
+		switch p.Text {
+		case ")", "]", ";", "{", "}", "=>":
+			return false
+		case ":":
+			return !colon
+		}
+		return true
+	}
+	return false
+}
+
+func closer(open byte) byte {
+	switch open {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	}
+	return '}'
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.src) {
+		return l.src[l.pos+n]
+	}
+	return 0
+}
+
+// skipSpace skips whitespace and returns the number of line breaks in it.
+func (l *lexer) skipSpace() int {
+	nl := 0
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case '\n':
+			nl++
+			l.pos++
+		case '\r':
+			if l.peek(1) != '\n' {
+				nl++
+			}
+			l.pos++
+		case ' ', '\t', '\v', '\f':
+			l.pos++
+		default:
+			if c < utf8.RuneSelf {
+				return nl
+			}
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			switch {
+			case r == '\u2028' || r == '\u2029':
+				nl++
+			case !isSpace(r):
+				return nl
+			}
+			l.pos += size
+		}
+	}
+	return nl
+}
+
+func (l *lexer) skipLine() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '\n' || c == '\r' || strings.HasPrefix(l.src[l.pos:], "\u2028") || strings.HasPrefix(l.src[l.pos:], "\u2029") {
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *lexer) scanString(quote byte) error {
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case quote:
+			l.pos++
+			return nil
+		case '\\':
+			l.pos++
+			if l.peek(0) == '\r' && l.peek(1) == '\n' {
+				l.pos++
+			}
+		case '\n', '\r':
+			return l.errorf("unterminated string")
+		}
+	}
+	return l.errorf("unterminated string")
+}
+
+// scanTemplate scans a template part starting at its ` or }, and reports
+// whether it ends in ${ rather than `.
+func (l *lexer) scanTemplate() (bool, error) {
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '`':
+			l.pos++
+			return false, nil
+		case '\\':
+			l.pos++
+		case '$':
+			if l.peek(1) == '{' {
+				l.pos += 2
+				return true, nil
+			}
+		}
+	}
+	return false, l.errorf("unterminated template literal")
+}
+
+func (l *lexer) scanNumber() {
+	if l.src[l.pos] == '0' && strings.IndexByte("xXoObB", l.peek(1)) >= 0 {
+		l.pos += 2
+		l.scanIdent()
+		return
+	}
+	dot := false
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isDigit(c) || c == '_':
+		case c == '.' && !dot:
+			dot = true
+		case c == 'e' || c == 'E':
+			if n := l.peek(1); n == '+' || n == '-' {
+				l.pos++
+			}
+			dot = true
+		default:
+			l.scanIdent() // BigInt suffix
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *lexer) scanRegexp() error {
+	class := false
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '/':
+			if !class {
+				l.pos++
+				l.scanIdent() // flags
+				return nil
+			}
+		case '\n', '\r':
+			return l.errorf("unterminated regular expression")
+		}
+	}
+	return l.errorf("unterminated regular expression")
+}
+
+// scanIdent skips identifier characters, including \u escapes and
+// non-ASCII letters.
+func (l *lexer) scanIdent() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isIdentStart(c) || isDigit(c):
+			l.pos++
+		case c == '\\' && l.peek(1) == 'u':
+			l.pos += 2
+			if l.peek(0) == '{' {
+				if end := strings.IndexByte(l.src[l.pos:], '}'); end >= 0 {
+					l.pos += end + 1
+				}
+			}
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			if isSpace(r) {
+				return
+			}
+			l.pos += size
+		default:
+			return
+		}
+	}
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isIdentStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$'
+}
+
+// isSpace reports whether the non-ASCII rune r is whitespace or a line
+// terminator.
+func isSpace(r rune) bool {
+	return r == '\u2028' || r == '\u2029' || r == '\ufeff' || unicode.Is(unicode.Zs, r)
+}
@@ -0,0 +1,218 @@
+package sourcemap
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Segment is one decoded mapping with absolute values. Fields is 1 for a
+// segment that marks generated code as unmapped, 4 when it maps to a source
+// position and 5 when it also names an identifier.
+type Segment struct {
+	Col     int
+	Fields  int
+	Src     int
+	SrcLine int
+	SrcCol  int
+	Name    int
+}
+
+// Mappings holds the segments of each generated line.
+type Mappings [][]Segment
+
+// DecodeMappings parses a source map "mappings" string.
+func DecodeMappings(s []byte) (Mappings, error) {
+	var m Mappings
+	var line []Segment
+	var src, srcLine, srcCol, name int
+	col := 0
+	for i := 0; i <= len(s); {
+		if i == len(s) || s[i] == ';' {
+			m = append(m, line)
+			line, col = nil, 0
+			i++
+			continue
+		}
+		if s[i] == ',' {
+			i++
+			continue
+		}
+
+		var vals [5]int
+		n := 0
+		for n < 5 && i < len(s) && s[i] != ',' && s[i] != ';' {
+			v, next, err := decodeVLQ(s, i)
+			if err != nil {
+				return nil, err
+			}
+			vals[n] = v
+			n++
+			i = next
+		}
+		if n != 1 && n != 4 && n != 5 {
+			return nil, fmt.Errorf("segment with %d fields on generated line %d", n, len(m))
+		}
+		col += vals[0]
+		seg := Segment{Col: col, Fields: n}
+		if n >= 4 {
+			src += vals[1]
+			srcLine += vals[2]
+			srcCol += vals[3]
+			seg.Src, seg.SrcLine, seg.SrcCol = src, srcLine, srcCol
+		}
+		if n == 5 {
+			name += vals[4]
+			seg.Name = name
+		}
+		line = append(line, seg)
+	}
+	return m, nil
+}
+
+// Encode serializes m back into a "mappings" string.
+func (m Mappings) Encode() []byte {
+	var b []byte
+	var src, srcLine, srcCol, name int
+	for i, line := range m {
+		if i > 0 {
+			b = append(b, ';')
+		}
+		col := 0
+		for j, seg := range line {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			b = appendVLQ(b, seg.Col-col)
+			col = seg.Col
+			if seg.Fields >= 4 {
+				b = appendVLQ(b, seg.Src-src)
+				b = appendVLQ(b, seg.SrcLine-srcLine)
+				b = appendVLQ(b, seg.SrcCol-srcCol)
+				src, srcLine, srcCol = seg.Src, seg.SrcLine, seg.SrcCol
+			}
+			if seg.Fields == 5 {
+				b = appendVLQ(b, seg.Name-name)
+				name = seg.Name
+			}
+		}
+	}
+	return b
+}
+
+// Edit replaces Length bytes at Offset of the generated code with Text.
+type Edit struct {
+	Offset int
+	Length int
+	Text   []byte
+}
+
+// position is a generated-code location: a 0-based line and a column in
+// UTF-16 code units, as source maps count them.
+type position struct {
+	line, col int
+}
+
+// positionOf returns the location of byte offset off in code.
+func positionOf(code []byte, off int) position {
+	prefix := code[:off]
+	line := bytes.Count(prefix, []byte{'\n'})
+	if i := bytes.LastIndexByte(prefix, '\n'); i >= 0 {
+		prefix = prefix[i+1:]
+	}
+	return position{line, utf16Len(prefix)}
+}
+
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// Apply returns the mappings for code after e is applied to it. Segments
+// inside the replaced span are dropped and everything after it is moved to
+// its new position. The inserted text is mapped line by line to source index
+// src, or marked unmapped when src is negative. Where the original code
+// resumes mid-line, the mapping that was in effect there is restored.
+func (m Mappings) Apply(code []byte, e Edit, src int) Mappings {
+	start := positionOf(code, e.Offset)
+	end := positionOf(code, e.Offset+e.Length)
+
+	// Where the inserted text ends in the new code.
+	newEnd := start
+	textLines := bytes.Split(e.Text, []byte{'\n'})
+	if len(textLines) == 1 {
+		newEnd.col += utf16Len(e.Text)
+	} else {
+		newEnd.line += len(textLines) - 1
+		newEnd.col = utf16Len(textLines[len(textLines)-1])
+	}
+
+	out := make(Mappings, 0, len(m)+newEnd.line-end.line)
+	out = append(out, m[:min(start.line, len(m))]...)
+	for len(out) <= newEnd.line {
+		out = append(out, nil)
+	}
+
+	// Segments before the edit on its first line.
+	if start.line < len(m) {
+		for _, seg := range m[start.line] {
+			if seg.Col < start.col {
+				out[start.line] = append(out[start.line], seg)
+			}
+		}
+	}
+
+	// The inserted text.
+	for i, text := range textLines {
+		if len(text) == 0 && (i == len(textLines)-1 || len(e.Text) == 0) {
+			break
+		}
+		seg := Segment{Fields: 1}
+		if src >= 0 {
+			seg = Segment{Fields: 4, Src: src, SrcLine: i}
+		}
+		if i == 0 {
+			seg.Col = start.col
+		}
+		out[start.line+i] = append(out[start.line+i], seg)
+	}
+
+	// The rest of the line the edit ends on, moved to where the text ends.
+	// Unless a segment starts exactly there, the code that follows was
+	// covered by the last segment before the end of the edit, or by none.
+	if end.line < len(m) {
+		resume := Segment{Fields: 1}
+		restored := false
+		for _, seg := range m[end.line] {
+			if seg.Col < end.col {
+				resume = seg
+				continue
+			}
+			if !restored && seg.Col > end.col {
+				resume.Col = newEnd.col
+				out[newEnd.line] = append(out[newEnd.line], resume)
+			}
+			restored = true
+			seg.Col = newEnd.col + seg.Col - end.col
+			out[newEnd.line] = append(out[newEnd.line], seg)
+		}
+		if !restored {
+			resume.Col = newEnd.col
+			out[newEnd.line] = append(out[newEnd.line], resume)
+		}
+	}
+
+	if end.line+1 < len(m) {
+		out = append(out, m[end.line+1:]...)
+	}
+	return out
+}
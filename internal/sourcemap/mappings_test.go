@@ -0,0 +1,161 @@
+package sourcemap
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMappingsRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"AAAA",
+		"AAAA,EAAE;AACA",
+		"AAAA;;IAAIA,CAAC",
+		";;A,CAAC,C",
+	} {
+		m, err := DecodeMappings([]byte(s))
+		if err != nil {
+			t.Errorf("DecodeMappings(%q): %v", s, err)
+			continue
+		}
+		if got := string(m.Encode()); got != s {
+			t.Errorf("DecodeMappings(%q).Encode() = %q", s, got)
+		}
+	}
+}
+
+func TestDecodeMappingsErrors(t *testing.T) {
+	for _, s := range []string{"AA", "AAA", "AA,A", "A!", "g"} {
+		if _, err := DecodeMappings([]byte(s)); err == nil {
+			t.Errorf("DecodeMappings(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func mapped(col, src, line, srcCol int) Segment {
+	return Segment{Col: col, Fields: 4, Src: src, SrcLine: line, SrcCol: srcCol}
+}
+
+func unmapped(col int) Segment {
+	return Segment{Col: col, Fields: 1}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		mappings string
+		edit     Edit
+		src      int
+		want     Mappings
+	}{
+		{
+			name:     "insert unmapped",
+			code:     "abc\ndef",
+			mappings: "AAAA,EAAE;AACA",
+			edit:     Edit{Offset: 1, Text: []byte("XY")},
+			src:      -1,
+			want: Mappings{
+				{mapped(0, 0, 0, 0), unmapped(1), mapped(3, 0, 0, 0), mapped(4, 0, 0, 2)},
+				{mapped(0, 0, 1, 2)},
+			},
+		},
+		{
+			name:     "replace with lines",
+			code:     "abc\ndef",
+			mappings: "AAAA,EAAE;AACA",
+			edit:     Edit{Offset: 1, Length: 1, Text: []byte("P\nQ")},
+			src:      1,
+			want: Mappings{
+				{mapped(0, 0, 0, 0), mapped(1, 1, 0, 0)},
+				{mapped(0, 1, 1, 0), mapped(1, 0, 0, 2)},
+				{mapped(0, 0, 1, 2)},
+			},
+		},
+		{
+			name:     "delete",
+			code:     "abcdef",
+			mappings: "AAAA,EAAE,EAAE",
+			edit:     Edit{Offset: 1, Length: 2},
+			src:      -1,
+			want:     Mappings{{mapped(0, 0, 0, 0), mapped(1, 0, 0, 2), mapped(2, 0, 0, 4)}},
+		},
+		{
+			name:     "join lines",
+			code:     "ab\ncd\nef",
+			mappings: "AAAA;AACA,CAAC;AACA",
+			edit:     Edit{Offset: 1, Length: 3},
+			src:      -1,
+			want: Mappings{
+				{mapped(0, 0, 0, 0), mapped(1, 0, 1, 1)},
+				{mapped(0, 0, 2, 1)},
+			},
+		},
+		{
+			name:     "columns count UTF-16 units",
+			code:     "é😀x",
+			mappings: "AAAA,GAAG",
+			edit:     Edit{Offset: len("é😀"), Text: []byte("Z")},
+			src:      -1,
+			want:     Mappings{{mapped(0, 0, 0, 0), unmapped(3), mapped(4, 0, 0, 3)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := DecodeMappings([]byte(tt.mappings))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := m.Apply([]byte(tt.code), tt.edit, tt.src)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply =\n  %v\nwant\n  %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	sm := []byte(`{"version":3,"sources":["cli.ts"],"sourcesContent":["x"],"names":[],"mappings":"AAAA,EAAE"}`)
+	code := []byte("abcdef")
+	out, err := Patch(sm, code, Edit{Offset: 2, Length: 2, Text: []byte("PAYLOAD")}, "payload.js")
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	var doc struct {
+		Sources        []string
+		SourcesContent []string
+		Mappings       string
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cli.ts", "payload.js"}; !reflect.DeepEqual(doc.Sources, want) {
+		t.Errorf("sources = %q, want %q", doc.Sources, want)
+	}
+	if want := []string{"x", "PAYLOAD"}; !reflect.DeepEqual(doc.SourcesContent, want) {
+		t.Errorf("sourcesContent = %q, want %q", doc.SourcesContent, want)
+	}
+	// The payload maps to source 1 and "ef", now at column 9, keeps the
+	// mapping of the replaced "cd".
+	if want := "AAAA,ECAA,ODAE"; doc.Mappings != want {
+		t.Errorf("mappings = %q, want %q", doc.Mappings, want)
+	}
+}
+
+func TestPatchRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		sm   string
+		edit Edit
+	}{
+		{"edit outside code", `{"mappings":""}`, Edit{Offset: 4, Length: 4}},
+		{"index map", `{"sections":[],"mappings":""}`, Edit{}},
+		{"bad mappings", `{"mappings":"!"}`, Edit{}},
+	}
+	for _, tt := range tests {
+		if _, err := Patch([]byte(tt.sm), []byte("abcdef"), tt.edit, "p.js"); err == nil {
+			t.Errorf("%s: Patch succeeded, want an error", tt.name)
+		}
+	}
+}
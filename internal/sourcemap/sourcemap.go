@@ -0,0 +1,136 @@
+// Package sourcemap reads the source maps embedded in a standalone Bun
+// executable and keeps them in step with edits to the code they describe. It
+// understands both JSON source maps and Bun's serialized form, which stores
+// the same VLQ mappings behind a small binary header.
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrIndexMap is returned for sectioned ("index") source maps, which Patch
+// does not rewrite.
+var ErrIndexMap = errors.New("index source maps are not supported")
+
+// Patch returns sm updated for e being applied to code. JSON maps gain a
+// source called name, whose content is the inserted text, and the inserted
+// lines map to it. Serialized maps keep their sources and mark the inserted
+// text as unmapped.
+func Patch(sm, code []byte, e Edit, name string) ([]byte, error) {
+	if e.Offset < 0 || e.Length < 0 || e.Offset+e.Length > len(code) {
+		return nil, fmt.Errorf("edit [%d, %d) outside code of %d bytes", e.Offset, e.Offset+e.Length, len(code))
+	}
+	if t := bytes.TrimLeft(sm, " \t\r\n"); len(t) > 0 && t[0] == '{' {
+		return patchJSON(sm, code, e, name)
+	}
+	return patchSerialized(sm, code, e)
+}
+
+func patchJSON(sm, code []byte, e Edit, name string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(sm, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc["sections"]; ok {
+		return nil, ErrIndexMap
+	}
+	var mappings string
+	if err := json.Unmarshal(doc["mappings"], &mappings); err != nil {
+		return nil, fmt.Errorf("mappings: %w", err)
+	}
+	m, err := DecodeMappings([]byte(mappings))
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []json.RawMessage
+	if raw, ok := doc["sources"]; ok {
+		if err := json.Unmarshal(raw, &sources); err != nil {
+			return nil, fmt.Errorf("sources: %w", err)
+		}
+	}
+	src := len(sources)
+	sources = append(sources, mustMarshal(name))
+	doc["sources"] = mustMarshal(sources)
+	if raw, ok := doc["sourcesContent"]; ok {
+		var contents []json.RawMessage
+		if err := json.Unmarshal(raw, &contents); err != nil {
+			return nil, fmt.Errorf("sourcesContent: %w", err)
+		}
+		for len(contents) < src {
+			contents = append(contents, json.RawMessage("null"))
+		}
+		doc["sourcesContent"] = mustMarshal(append(contents, mustMarshal(string(e.Text))))
+	}
+
+	doc["mappings"] = mustMarshal(string(m.Apply(code, e, src).Encode()))
+	return json.Marshal(doc)
+}
+
+func mustMarshal(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Bun's serialized source map: a header, one string pointer per source for
+// its name and one for its compressed contents, the VLQ mappings, then the
+// strings the pointers refer to. Pointers are relative to the start of the
+// map.
+const (
+	serializedHeaderSize = 8
+	stringPointerSize    = 8
+)
+
+// serializedHeader returns the number of sources in a serialized map and the
+// bounds of its mappings.
+func serializedHeader(sm []byte) (count, mapStart, mapEnd uint64, err error) {
+	if len(sm) < serializedHeaderSize {
+		return 0, 0, 0, errors.New("serialized source map truncated")
+	}
+	count = uint64(binary.LittleEndian.Uint32(sm[0:]))
+	mapLen := uint64(binary.LittleEndian.Uint32(sm[4:]))
+	mapStart = serializedHeaderSize + 2*count*stringPointerSize
+	mapEnd = mapStart + mapLen
+	if mapEnd > uint64(len(sm)) {
+		return 0, 0, 0, fmt.Errorf("serialized source map: %d sources and %d bytes of mappings do not fit in %d bytes", count, mapLen, len(sm))
+	}
+	return count, mapStart, mapEnd, nil
+}
+
+func patchSerialized(sm, code []byte, e Edit) ([]byte, error) {
+	count, mapStart, mapEnd, err := serializedHeader(sm)
+	if err != nil {
+		return nil, err
+	}
+	mapLen := mapEnd - mapStart
+
+	m, err := DecodeMappings(sm[mapStart:mapEnd])
+	if err != nil {
+		return nil, err
+	}
+	mappings := m.Apply(code, e, -1).Encode()
+	delta := int64(len(mappings)) - int64(mapLen)
+
+	out := make([]byte, 0, int64(len(sm))+delta)
+	out = binary.LittleEndian.AppendUint32(out, uint32(count))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(mappings)))
+	for i := uint64(0); i < 2*count; i++ {
+		p := sm[serializedHeaderSize+i*stringPointerSize:]
+		off := int64(binary.LittleEndian.Uint32(p))
+		length := binary.LittleEndian.Uint32(p[4:])
+		if uint64(off) >= mapEnd {
+			off += delta
+		}
+		out = binary.LittleEndian.AppendUint32(out, uint32(off))
+		out = binary.LittleEndian.AppendUint32(out, length)
+	}
+	out = append(out, mappings...)
+	return append(out, sm[mapEnd:]...), nil
+}
@@ -0,0 +1,123 @@
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Source is an original file a source map was generated from.
+type Source struct {
+	Name     string
+	Contents []byte // nil if the map does not carry the file
+}
+
+// zstdMagic starts every zstd frame. Bun compresses the sources it stores in
+// serialized maps.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Sources returns the sources recorded in sm, in the map's order. Names are
+// as written in the map, with any sourceRoot prepended; sections of an index
+// map are flattened.
+func Sources(sm []byte) ([]Source, error) {
+	if t := bytes.TrimLeft(sm, " \t\r\n"); len(t) > 0 && t[0] == '{' {
+		return jsonSources(sm)
+	}
+	return serializedSources(sm)
+}
+
+type jsonMap struct {
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []*string `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+	Sections       []struct {
+		Map json.RawMessage `json:"map"`
+	} `json:"sections"`
+}
+
+func jsonSources(sm []byte) ([]Source, error) {
+	var doc jsonMap
+	if err := json.Unmarshal(sm, &doc); err != nil {
+		return nil, err
+	}
+	var out []Source
+	for i, sec := range doc.Sections {
+		srcs, err := jsonSources(sec.Map)
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", i, err)
+		}
+		out = append(out, srcs...)
+	}
+	for i, name := range doc.Sources {
+		s := Source{}
+		if name != nil {
+			s.Name = *name
+			if doc.SourceRoot != "" {
+				s.Name = joinRoot(doc.SourceRoot, s.Name)
+			}
+		}
+		if i < len(doc.SourcesContent) && doc.SourcesContent[i] != nil {
+			s.Contents = []byte(*doc.SourcesContent[i])
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func joinRoot(root, name string) string {
+	if strings.Contains(name, "://") || strings.HasPrefix(name, "/") {
+		return name
+	}
+	return strings.TrimSuffix(root, "/") + "/" + name
+}
+
+func serializedSources(sm []byte) ([]Source, error) {
+	count, _, _, err := serializedHeader(sm)
+	if err != nil {
+		return nil, err
+	}
+	str := func(i uint64) ([]byte, error) {
+		p := sm[serializedHeaderSize+i*stringPointerSize:]
+		off := uint64(binary.LittleEndian.Uint32(p))
+		length := uint64(binary.LittleEndian.Uint32(p[4:]))
+		if off+length > uint64(len(sm)) {
+			return nil, fmt.Errorf("serialized source map: string [%d, %d) outside %d bytes", off, off+length, len(sm))
+		}
+		return sm[off : off+length], nil
+	}
+
+	var dec *zstd.Decoder
+	out := make([]Source, count)
+	for i := range out {
+		name, err := str(uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		out[i].Name = string(name)
+		contents, err := str(count + uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		if len(contents) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(contents, zstdMagic) {
+			out[i].Contents = bytes.Clone(contents)
+			continue
+		}
+		if dec == nil {
+			if dec, err = zstd.NewReader(nil); err != nil {
+				return nil, err
+			}
+			defer dec.Close()
+		}
+		if out[i].Contents, err = dec.DecodeAll(contents, nil); err != nil {
+			return nil, fmt.Errorf("source %q: %w", name, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package sourcemap
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// serializedMap builds a map in Bun's serialized format: the header, name
+// and contents pointers, the mappings, then the strings. Contents are
+// zstd-compressed when compress is set, as Bun stores them.
+func serializedMap(t *testing.T, srcs []Source, mappings string, compress bool) []byte {
+	t.Helper()
+	var enc *zstd.Encoder
+	if compress {
+		var err error
+		if enc, err = zstd.NewWriter(nil); err != nil {
+			t.Fatal(err)
+		}
+		defer enc.Close()
+	}
+	strs := make([][]byte, 2*len(srcs))
+	for i, s := range srcs {
+		strs[i] = []byte(s.Name)
+		strs[len(srcs)+i] = s.Contents
+		if compress && s.Contents != nil {
+			strs[len(srcs)+i] = enc.EncodeAll(s.Contents, nil)
+		}
+	}
+
+	out := binary.LittleEndian.AppendUint32(nil, uint32(len(srcs)))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(mappings)))
+	off := serializedHeaderSize + len(strs)*stringPointerSize + len(mappings)
+	for _, s := range strs {
+		out = binary.LittleEndian.AppendUint32(out, uint32(off))
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(s)))
+		off += len(s)
+	}
+	out = append(out, mappings...)
+	for _, s := range strs {
+		out = append(out, s...)
+	}
+	return out
+}
+
+func TestSources(t *testing.T) {
+	src := func(name, contents string) Source { return Source{Name: name, Contents: []byte(contents)} }
+	tests := []struct {
+		name string
+		sm   func(t *testing.T) []byte
+		want []Source
+	}{
+		{"json", func(t *testing.T) []byte {
+			return []byte(`{"version":3,"sources":["a.ts","b.ts"],"sourcesContent":["let a = 1;",null],"mappings":"AAAA"}`)
+		}, []Source{src("a.ts", "let a = 1;"), {Name: "b.ts"}}},
+		{"json with sourceRoot", func(t *testing.T) []byte {
+			return []byte(`{"version":3,"sourceRoot":"src/","sources":["a.ts","/abs/b.ts","webpack://x/c.ts"],"mappings":""}`)
+		}, []Source{{Name: "src/a.ts"}, {Name: "/abs/b.ts"}, {Name: "webpack://x/c.ts"}}},
+		{"json with fewer contents than sources", func(t *testing.T) []byte {
+			return []byte(`{"version":3,"sources":["a.ts","b.ts"],"sourcesContent":["a"],"mappings":""}`)
+		}, []Source{src("a.ts", "a"), {Name: "b.ts"}}},
+		{"index map", func(t *testing.T) []byte {
+			return []byte(` {"version":3,"sections":[
+				{"offset":{"line":0,"column":0},"map":{"version":3,"sourceRoot":"one","sources":["a.ts"],"sourcesContent":["a"],"mappings":""}},
+				{"offset":{"line":9,"column":0},"map":{"version":3,"sources":["b.ts"],"sourcesContent":["b"],"mappings":""}}
+			]}`)
+		}, []Source{src("one/a.ts", "a"), src("b.ts", "b")}},
+		{"serialized", func(t *testing.T) []byte {
+			return serializedMap(t, []Source{src("a.ts", "let a = 1;"), {Name: "b.ts"}}, "AAAA", false)
+		}, []Source{src("a.ts", "let a = 1;"), {Name: "b.ts"}}},
+		{"serialized with zstd contents", func(t *testing.T) []byte {
+			return serializedMap(t, []Source{src("a.ts", strings.Repeat("let a = 1;\n", 50)), src("b.ts", "b")}, "AAAA;AACA", true)
+		}, []Source{src("a.ts", strings.Repeat("let a = 1;\n", 50)), src("b.ts", "b")}},
+		{"serialized without sources", func(t *testing.T) []byte {
+			return serializedMap(t, nil, "", false)
+		}, []Source{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sources(tt.sm(t))
+			if err != nil {
+				t.Fatalf("Sources: %v", err)
+			}
+			if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sources =\n  %q\nwant\n  %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcesRejects(t *testing.T) {
+	valid := func(t *testing.T) []byte {
+		return serializedMap(t, []Source{{Name: "a.ts", Contents: []byte("a")}}, "AAAA", false)
+	}
+	tests := []struct {
+		name    string
+		sm      func(t *testing.T) []byte
+		wantErr string
+	}{
+		{"truncated header", func(t *testing.T) []byte { return []byte{1, 0, 0} }, "truncated"},
+		{"pointers past the buffer", func(t *testing.T) []byte {
+			sm := valid(t)
+			binary.LittleEndian.PutUint32(sm[0:], 1000)
+			return sm
+		}, "do not fit"},
+		{"name past the buffer", func(t *testing.T) []byte {
+			sm := valid(t)
+			binary.LittleEndian.PutUint32(sm[serializedHeaderSize:], uint32(len(sm)))
+			return sm
+		}, "outside"},
+		{"contents past the buffer", func(t *testing.T) []byte {
+			sm := valid(t)
+			binary.LittleEndian.PutUint32(sm[serializedHeaderSize+stringPointerSize+4:], 1<<31)
+			return sm
+		}, "outside"},
+		{"corrupt zstd contents", func(t *testing.T) []byte {
+			corrupt := append([]byte(nil), zstdMagic...)
+			return serializedMap(t, []Source{{Name: "a.ts", Contents: append(corrupt, 0xff, 0xff)}}, "", false)
+		}, `source "a.ts"`},
+		{"malformed json", func(t *testing.T) []byte { return []byte(`{"sources":[`) }, ""},
+		{"malformed section", func(t *testing.T) []byte { return []byte(`{"sections":[{"map":{"sources":7}}]}`) }, "section 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Sources(tt.sm(t)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Sources = %q, %v; want an error containing %q", got, err, tt.wantErr)
+			}
+		})
+	}
+}
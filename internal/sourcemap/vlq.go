@@ -0,0 +1,66 @@
+package sourcemap
+
+import (
+	"errors"
+	"fmt"
+)
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+var base64Values = func() (t [256]int8) {
+	for i := range t {
+		t[i] = -1
+	}
+	for i := 0; i < len(base64Chars); i++ {
+		t[base64Chars[i]] = int8(i)
+	}
+	return
+}()
+
+var errTruncatedVLQ = errors.New("truncated VLQ")
+
+// decodeVLQ reads one base64 VLQ value from s starting at i and returns it
+// with the index just past it.
+func decodeVLQ(s []byte, i int) (int, int, error) {
+	var v, shift int
+	for {
+		if i >= len(s) {
+			return 0, i, errTruncatedVLQ
+		}
+		d := base64Values[s[i]]
+		if d < 0 {
+			return 0, i, fmt.Errorf("invalid VLQ character %q at %d", s[i], i)
+		}
+		i++
+		v |= int(d&31) << shift
+		if d&32 == 0 {
+			break
+		}
+		shift += 5
+		if shift > 31 {
+			return 0, i, fmt.Errorf("VLQ value too large at %d", i)
+		}
+	}
+	if v&1 != 0 {
+		return -(v >> 1), i, nil
+	}
+	return v >> 1, i, nil
+}
+
+func appendVLQ(b []byte, v int) []byte {
+	u := v << 1
+	if v < 0 {
+		u = (-v << 1) | 1
+	}
+	for {
+		d := u & 31
+		u >>= 5
+		if u != 0 {
+			d |= 32
+		}
+		b = append(b, base64Chars[d])
+		if u == 0 {
+			return b
+		}
+	}
+}
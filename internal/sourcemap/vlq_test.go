@@ -0,0 +1,47 @@
+package sourcemap
+
+import "testing"
+
+func TestVLQ(t *testing.T) {
+	tests := []struct {
+		v   int
+		enc string
+	}{
+		{0, "A"},
+		{1, "C"},
+		{-1, "D"},
+		{15, "e"},
+		{-15, "f"},
+		{16, "gB"},
+		{-16, "hB"},
+		{123, "2H"},
+		{1 << 20, "ggggC"},
+		{-(1<<30 - 1), "//////B"},
+	}
+	for _, tt := range tests {
+		if got := string(appendVLQ(nil, tt.v)); got != tt.enc {
+			t.Errorf("appendVLQ(%d) = %q, want %q", tt.v, got, tt.enc)
+		}
+		v, next, err := decodeVLQ([]byte(tt.enc+","), 0)
+		if err != nil || v != tt.v || next != len(tt.enc) {
+			t.Errorf("decodeVLQ(%q) = %d, %d, %v; want %d, %d, nil", tt.enc, v, next, err, tt.v, len(tt.enc))
+		}
+	}
+}
+
+func TestDecodeVLQErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"truncated", "g"},
+		{"invalid character", "!"},
+		{"too large", "ggggggggB"},
+	}
+	for _, tt := range tests {
+		if _, _, err := decodeVLQ([]byte(tt.in), 0); err == nil {
+			t.Errorf("%s: decodeVLQ(%q) succeeded, want an error", tt.name, tt.in)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Package txn applies a sequence of file-system mutations so that they can
+// be rolled back as a unit. Every file is written to a temp file in the
+// target's directory, fsynced and renamed into place; whatever it replaces is
+// linked or copied aside first and kept until Commit. Each step is recorded in a journal on disk before
+// it runs, so an interrupted transaction can be rolled back by a later
+// process with Recover.
+package txn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrAborted is returned by steps attempted after the transaction was rolled
+// back, e.g. from a signal handler, and by Rollback after Commit.
+var ErrAborted = errors.New("transaction aborted")
+
+// Op is the kind of mutation a Step performed.
+type Op string
+
+const (
+	OpWrite  Op = "write"  // file created or replaced
+	OpMkdir  Op = "mkdir"  // directory created
+	OpRemove Op = "remove" // file or empty directory removed
+)
+
+// Step is one journaled mutation. Stash holds what used to be at Path, if
+// anything, until the transaction commits; Temp is where OpWrite stages the
+// new contents.
+type Step struct {
+	Op    Op     `json:"op"`
+	Path  string `json:"path"`
+	Temp  string `json:"temp,omitempty"`
+	Stash string `json:"stash,omitempty"`
+	Dir   bool   `json:"dir,omitempty"` // OpRemove removed a directory
+}
+
+// Tx is an open transaction.
+type Tx struct {
+	mu      sync.Mutex
+	journal string
+	steps   []Step
+	done    bool
+	// committed is set by Commit, after which Rollback does nothing.
+	committed bool
+}
+
+// Begin starts a transaction journaled at journalPath. It fails if a journal
+// already exists there; call Recover first.
+func Begin(journalPath string) (*Tx, error) {
+	if _, err := os.Stat(journalPath); err == nil {
+		return nil, fmt.Errorf("an interrupted transaction is pending (%s)", journalPath)
+	}
+	tx := &Tx{journal: journalPath}
+	if err := tx.save(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Recover rolls back the transaction journaled at journalPath, if any, and
+// reports whether there was one.
+func Recover(journalPath string) (bool, error) {
+	data, err := os.ReadFile(journalPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tx := &Tx{journal: journalPath}
+	if err := json.Unmarshal(data, &tx.steps); err != nil {
+		return true, fmt.Errorf("reading journal %s: %w", journalPath, err)
+	}
+	return true, tx.Rollback()
+}
+
+// JournalPath returns where the transaction is journaled.
+func (tx *Tx) JournalPath() string {
+	return tx.journal
+}
+
+// WriteFile atomically creates or replaces path with the bytes produced by
+// write. write receives the temp file, which is synced and renamed over path
+// once write returns successfully. An existing file is hard-linked (or, where
+// that fails, copied) to its stash first, so path is never missing.
+func (tx *Tx) WriteFile(path string, mode os.FileMode, write func(f *os.File) error) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrAborted
+	}
+
+	step := Step{Op: OpWrite, Path: path, Temp: tx.sidecarName(path, "tmp")}
+	if _, err := os.Lstat(path); err == nil {
+		step.Stash = tx.sidecarName(path, "prev")
+	}
+	if err := tx.record(step); err != nil {
+		return err
+	}
+
+	tmp, err := os.OpenFile(step.Temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(mode)
+	if err == nil {
+		err = write(tmp)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if step.Stash != "" {
+		if err := stashCopy(path, step.Stash); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(step.Temp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// CopyFile atomically creates or replaces dst with the contents of src.
+func (tx *Tx) CopyFile(src, dst string, mode os.FileMode) error {
+	return tx.WriteFile(dst, mode, func(f *os.File) error {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(f, in)
+		return err
+	})
+}
+
+// MkdirAll creates path and any missing parents, journaling each directory it
+// creates so that rollback removes exactly those.
+func (tx *Tx) MkdirAll(path string, perm os.FileMode) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrAborted
+	}
+
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil {
+			break
+		}
+		missing = append(missing, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := tx.record(Step{Op: OpMkdir, Path: missing[i]}); err != nil {
+			return err
+		}
+		if err := os.Mkdir(missing[i], perm); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes a file or empty directory. Files are moved aside rather than
+// deleted so that rollback can put them back.
+func (tx *Tx) Remove(path string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrAborted
+	}
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if err := tx.record(Step{Op: OpRemove, Path: path, Dir: true}); err != nil {
+			return err
+		}
+		return os.Remove(path)
+	}
+	step := Step{Op: OpRemove, Path: path, Stash: tx.sidecarName(path, "prev")}
+	if err := tx.record(step); err != nil {
+		return err
+	}
+	return os.Rename(path, step.Stash)
+}
+
+// Commit makes the transaction permanent: the journal is removed, so that
+// nothing can roll it back any more, and then stashed files are deleted.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrAborted
+	}
+	if err := os.Remove(tx.journal); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	tx.done, tx.committed = true, true
+
+	var errs []error
+	for _, s := range tx.steps {
+		if s.Stash != "" {
+			if err := os.Remove(s.Stash); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rollback undoes every recorded step in reverse order and removes the
+// journal. Steps that were recorded but never ran are undone harmlessly. The
+// journal is kept if anything could not be restored. After Commit it changes
+// nothing and returns ErrAborted.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.committed {
+		return ErrAborted
+	}
+	tx.done = true
+
+	var errs []error
+	for i := len(tx.steps) - 1; i >= 0; i-- {
+		if err := undo(tx.steps[i]); err != nil {
+			errs = append(errs, fmt.Errorf("undo %s %s: %w", tx.steps[i].Op, tx.steps[i].Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if err := os.Remove(tx.journal); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func undo(s Step) error {
+	switch s.Op {
+	case OpWrite:
+		if s.Temp != "" {
+			if err := removeIfExists(s.Temp); err != nil {
+				return err
+			}
+		}
+		if s.Stash == "" {
+			return removeIfExists(s.Path)
+		}
+		if _, err := os.Lstat(s.Stash); os.IsNotExist(err) {
+			// The stash was never created, so the original is still in place.
+			return nil
+		}
+		return os.Rename(s.Stash, s.Path)
+	case OpMkdir:
+		err := os.Remove(s.Path)
+		if err != nil && (os.IsNotExist(err) || isNotEmpty(s.Path)) {
+			return nil
+		}
+		return err
+	case OpRemove:
+		if s.Dir {
+			if err := os.Mkdir(s.Path, 0o755); err != nil && !os.IsExist(err) {
+				return err
+			}
+			return nil
+		}
+		if _, err := os.Lstat(s.Stash); os.IsNotExist(err) {
+			return nil
+		}
+		return os.Rename(s.Stash, s.Path)
+	}
+	return fmt.Errorf("unknown journal op %q", s.Op)
+}
+
+// record appends s to the journal and syncs it to disk before the caller
+// performs the mutation.
+func (tx *Tx) record(s Step) error {
+	tx.steps = append(tx.steps, s)
+	if err := tx.save(); err != nil {
+		tx.steps = tx.steps[:len(tx.steps)-1]
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+func (tx *Tx) save() error {
+	data, err := json.MarshalIndent(tx.steps, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := tx.journal + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, tx.journal); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(tx.journal))
+}
+
+// sidecarName returns a hidden path next to path that is unique within the
+// transaction, so that a file written twice keeps both stashes apart.
+func (tx *Tx) sidecarName(path, kind string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.claudeload-%s-%d", filepath.Base(path), kind, len(tx.steps)))
+}
+
+// stashCopy makes stash a copy of path, as a hard link where the file system
+// allows it and a synced copy of the contents and mode otherwise.
+func stashCopy(path, stash string) error {
+	if err := os.Link(path, stash); err == nil {
+		return nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(stash, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(stash)
+	}
+	return err
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func isNotEmpty(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
+// syncDir flushes a directory entry change to disk. Not every platform can
+// open a directory for syncing, so failures to do so are ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	d.Sync()
+	return nil
+}
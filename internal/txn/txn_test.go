@@ -0,0 +1,220 @@
+package txn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeString(s string) func(f *os.File) error {
+	return func(f *os.File) error {
+		_, err := f.WriteString(s)
+		return err
+	}
+}
+
+func mustWrite(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertTree checks that dir holds exactly the files in want, by path
+// relative to dir, with the given contents.
+func assertTree(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		got[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range want {
+		if got[name] != contents {
+			t.Errorf("%s = %q, want %q", name, got[name], contents)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("unexpected file %s", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub")); !os.IsNotExist(err) {
+		t.Errorf("directory created by the transaction was not removed: %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail runs the failing step of the transaction and returns its
+		// error.
+		fail func(t *testing.T, tx *Tx, dir string) error
+	}{
+		{"stash fails", func(t *testing.T, tx *Tx, dir string) error {
+			// A non-empty directory where the stash of bin should go
+			// makes both linking and copying bin aside fail.
+			stash := tx.sidecarName(filepath.Join(dir, "bin"), "prev")
+			if err := os.Mkdir(stash, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			mustWrite(t, filepath.Join(stash, "x"), "")
+			defer os.RemoveAll(stash)
+			return tx.WriteFile(filepath.Join(dir, "bin"), 0o755, writeString("patched"))
+		}},
+		{"write fails", func(t *testing.T, tx *Tx, dir string) error {
+			return tx.WriteFile(filepath.Join(dir, "bin"), 0o755, func(f *os.File) error {
+				f.WriteString("half")
+				return errors.New("disk full")
+			})
+		}},
+		{"aborted", func(t *testing.T, tx *Tx, dir string) error {
+			tx.Rollback()
+			return tx.WriteFile(filepath.Join(dir, "bin"), 0o755, writeString("patched"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			mustWrite(t, filepath.Join(dir, "bin"), "original")
+			mustWrite(t, filepath.Join(dir, "old.txt"), "old")
+			journal := filepath.Join(dir, "journal.json")
+
+			tx, err := Begin(journal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.WriteFile(filepath.Join(dir, "payload.js"), 0o644, writeString("payload")); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.MkdirAll(filepath.Join(dir, "sub", "plugins"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Remove(filepath.Join(dir, "old.txt")); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.fail(t, tx, dir); err == nil {
+				t.Fatal("failing step succeeded")
+			}
+			if err := tx.Rollback(); err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			assertTree(t, dir, map[string]string{"bin": "original", "old.txt": "old"})
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "bin"), "original")
+	journal := filepath.Join(dir, "journal.json")
+
+	tx, err := Begin(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile(filepath.Join(dir, "bin"), 0o755, writeString("patched")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The process dies here: the journal is all a later run has.
+
+	if _, err := Begin(journal); err == nil {
+		t.Error("Begin succeeded with a transaction pending")
+	}
+	pending, err := Recover(journal)
+	if err != nil || !pending {
+		t.Fatalf("Recover = %t, %v; want true, nil", pending, err)
+	}
+	assertTree(t, dir, map[string]string{"bin": "original"})
+	if pending, err := Recover(journal); err != nil || pending {
+		t.Errorf("second Recover = %t, %v; want false, nil", pending, err)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "bin"), "original")
+	mustWrite(t, filepath.Join(dir, "old.txt"), "old")
+
+	tx, err := Begin(filepath.Join(dir, "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.CopyFile(filepath.Join(dir, "bin"), filepath.Join(dir, "bin.original"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile(filepath.Join(dir, "bin"), 0o755, writeString("patched")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Remove(filepath.Join(dir, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	assertTree(t, dir, map[string]string{"bin": "patched", "bin.original": "original"})
+	if err := tx.Remove(filepath.Join(dir, "bin")); !errors.Is(err, ErrAborted) {
+		t.Errorf("Remove after Commit = %v, want ErrAborted", err)
+	}
+	// A signal handler racing the commit must not undo it.
+	if err := tx.Rollback(); !errors.Is(err, ErrAborted) {
+		t.Errorf("Rollback after Commit = %v, want ErrAborted", err)
+	}
+	assertTree(t, dir, map[string]string{"bin": "patched", "bin.original": "original"})
+}
+
+// Replacing a file stashes a second link to the original, so the path
+// always names a complete file, and keeps the original's mode for rollback.
+func TestWriteFileStashesOriginal(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	mustWrite(t, bin, "original")
+	if err := os.Chmod(bin, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := Begin(filepath.Join(dir, "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stash := tx.sidecarName(bin, "prev")
+	if err := tx.WriteFile(bin, 0o755, writeString("patched")); err != nil {
+		t.Fatal(err)
+	}
+	stashed, err := os.Stat(stash)
+	if err != nil {
+		t.Fatalf("stash: %v", err)
+	}
+	if !os.SameFile(before, stashed) {
+		t.Error("stash is not the original file")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	after, err := os.Stat(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || after.Mode() != before.Mode() {
+		t.Errorf("rollback restored mode %v, want the original file with %v", after.Mode(), before.Mode())
+	}
+}